@@ -3,278 +3,805 @@
 package client
 
 import (
-	"bytes"
-	"compress/gzip"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"net"
-	//"reflect"
+	"sync"
 	"time"
 
 	"github.com/lelandbatey/minesweeper-solver/defusedivision"
+	"github.com/lelandbatey/minesweeper-solver/protocol"
 	"github.com/y0ssar1an/q"
 )
 
 // DefuseDivision -- How does the client server model work?
 //
-// The client sends messages over a tcp socket. The boundary between messages
-// is a null byte. Each message is gzipped before it's sent over the wire.
+// The client sends messages over a tcp socket, framed as the protocol package
+// describes: each message is gzipped JSON, followed by the byte sequence
+// "\x00\x01\x00".
 //
 // As the client, we'll need to open a tcp socket then wait for an initial
 // message telling us about ourselves. From there on out, the server will
 // respond with messages outlined here:
 // https://github.com/lelandbatey/defuse_division/blob/master/architecture.md
 
+// ErrClosed is returned by operations on a Client after Close.
+var ErrClosed = errors.New("client is closed")
+
+// ErrDisconnected is returned by commands whose connection was lost before the
+// server confirmed them. A Client which can reconnect is resynced by Resync.
+var ErrDisconnected = errors.New("disconnected")
+
+// DefaultTimeout is the Timeout of a new Client.
+const DefaultTimeout = 5 * time.Second
+
+// The defaults for reconnecting a Client.
+const (
+	DefaultReconnects = 5
+	DefaultBackoff    = 100 * time.Millisecond
+	DefaultMaxBackoff = 5 * time.Second
+)
+
 // A Client struct holds a connection and some basic information about a player
 // that this connection represents.
+//
+// Every operation takes a context, and returns its error if the context is
+// cancelled or its deadline passes first. Close stops the goroutine reading
+// from the connection; a Client must be closed once it is no longer needed.
+//
+// The server sends messages whenever any player acts, so each message is
+// dispatched by its kind: to the handlers registered with Handle, and to the
+// command waiting for it as its confirmation, if any. A command only takes
+// the message which confirms it, such as the update-selected naming this
+// player's new cursor for a move, and never another player's update.
+//
+// A Client created by New or Dial reconnects when its connection drops,
+// waiting Backoff before the first attempt and twice as long after each
+// failed one. Commands waiting on the lost connection fail with
+// ErrDisconnected; Resync then waits for the server to introduce the player
+// again, and returns the board as the server now has it.
 type Client struct {
-	Connection net.Conn
 	// Name will be "example" when initially created, but after the first
 	// message which is a Player struct is read, the name of this Client struct
-	// will match the name of the Player.
+	// will match the name of the Player. It is set before Player returns, and
+	// again before Resync returns, since a server may rename a player who
+	// reconnects.
 	Name   string
-	Msgs   chan []byte
 	X      int
 	Y      int
 	Living bool
+	// Timeout is the longest to wait for the server to answer a command,
+	// within any deadline of the context. Zero waits as long as the context
+	// allows. It also bounds each attempt to reconnect.
+	Timeout time.Duration
+	// ChordCommand is the command which chords on a server supporting one.
+	// When empty, ChordXY probes each neighbor instead.
+	ChordCommand string
+	// SelectCommand is the command which moves the cursor straight to a
+	// cell on a server supporting one, sent as {SelectCommand: [X, Y]}.
+	// When empty, the cursor is moved one cell at a time.
+	SelectCommand string
+	// Reconnects is how many attempts in a row are made to reconnect after
+	// the connection drops. Zero gives up at once. Like the backoffs, it
+	// must be set before the connection drops.
+	Reconnects int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Log receives a line for each attempt to reconnect, unless it is nil.
+	// Like Reconnects, it must be set before the connection drops.
+	Log io.Writer
+
+	// dial opens a new connection, or is nil if the client can't reconnect
+	dial func(ctx context.Context) (net.Conn, error)
+
+	mu sync.Mutex
+	// name is Name, guarded by mu, for the goroutine reading messages
+	name string
+	// player is this client's player, as the server introduced it
+	player defusedivision.Player
+	// state is the last state the server sent
+	state    defusedivision.State
+	waiters  []*waiter
+	handlers map[string][]func(defusedivision.Message)
+	session  *session
+
+	done      chan struct{}
+	closeOnce sync.Once
+	reading   sync.WaitGroup
+	// stopped is closed once the client gives up on the server, after
+	// setting readErr
+	stopped chan struct{}
+	readErr error
 }
 
-func New(host string, port string) (*Client, error) {
-	addr := fmt.Sprintf("%s:%s", host, port)
-	c, err := net.Dial("tcp", addr)
+// A session is a single connection to the server.
+type session struct {
+	conn net.Conn
+	enc  *protocol.Encoder
+	// hello is closed once the server has introduced the player
+	hello   chan struct{}
+	greeted bool
+	// stated is closed once the server has sent a state after introducing
+	// the player
+	stated   chan struct{}
+	hasState bool
+	// lost is closed once the connection fails, after setting err
+	lost chan struct{}
+	err  error
+	// next is closed once the session which replaces this one is ready
+	next chan struct{}
+}
+
+func newSession(conn net.Conn) *session {
+	return &session{
+		conn:   conn,
+		enc:    protocol.NewEncoder(conn),
+		hello:  make(chan struct{}),
+		stated: make(chan struct{}),
+		lost:   make(chan struct{}),
+		next:   make(chan struct{}),
+	}
+}
+
+// A waiter is a command waiting for the message which confirms it.
+type waiter struct {
+	match func(defusedivision.Message) bool
+	reply chan defusedivision.Message
+	// lost is closed if the command's connection is lost
+	lost    chan struct{}
+	session *session
+}
+
+// New connects to the DefuseDivision server at host and port, giving up when
+// ctx is done. The client reconnects to the same address.
+func New(ctx context.Context, host string, port string) (*Client, error) {
+	addr := net.JoinHostPort(host, port)
+	return Dial(ctx, func(ctx context.Context) (net.Conn, error) {
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, "tcp", addr)
+	})
+}
+
+// Dial returns a Client talking over the connection opened by dial, giving up
+// when ctx is done. The client calls dial again to reconnect.
+func Dial(ctx context.Context, dial func(ctx context.Context) (net.Conn, error)) (*Client, error) {
+	conn, err := dial(ctx)
 	if err != nil {
 		return nil, err
 	}
-	rv := Client{
-		Connection: c,
+	return newClient(conn, dial), nil
+}
+
+// NewConn returns a Client talking over an established connection, and starts
+// reading messages from it. The client can't reconnect once conn drops.
+func NewConn(conn net.Conn) *Client {
+	return newClient(conn, nil)
+}
+
+func newClient(conn net.Conn, dial func(ctx context.Context) (net.Conn, error)) *Client {
+	c := &Client{
 		Name:       "example",
-		Msgs:       make(chan []byte),
 		X:          0,
 		Y:          0,
 		Living:     true,
+		Timeout:    DefaultTimeout,
+		Reconnects: DefaultReconnects,
+		Backoff:    DefaultBackoff,
+		MaxBackoff: DefaultMaxBackoff,
+		dial:       dial,
+		name:       "example",
+		handlers:   map[string][]func(defusedivision.Message){},
+		session:    newSession(conn),
+		done:       make(chan struct{}),
+		stopped:    make(chan struct{}),
+	}
+	c.reading.Add(1)
+	go c.run(c.session)
+	return c
+}
+
+// Close closes the connection and waits for the reader to stop. Closing a
+// Client more than once returns ErrClosed.
+func (c *Client) Close() error {
+	err := ErrClosed
+	c.closeOnce.Do(func() {
+		close(c.done)
+		err = c.current().conn.Close()
+	})
+	c.reading.Wait()
+	return err
+}
+
+// Handle registers f to be called with every later message of the given kind,
+// e.g. defusedivision.KindUpdateSelected to follow the other players' cursors.
+// Handlers are called one at a time on the goroutine reading from the
+// connection, so they must not block or call the Client's commands.
+func (c *Client) Handle(kind string, f func(defusedivision.Message)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.handlers[kind] = append(c.handlers[kind], f)
+}
+
+// Player waits for the server to say which player this client plays as, which
+// it does as soon as the connection opens, or reopens. The cursor is taken to
+// be where the server says it is.
+func (c *Client) Player(ctx context.Context) (defusedivision.Player, error) {
+	s := c.current()
+	for {
+		select {
+		case <-s.lost:
+			// the player of a lost session is out of date, so wait for
+			// the next session to introduce it again
+			select {
+			case <-s.next:
+				s = c.current()
+				continue
+			case <-c.stopped:
+				return defusedivision.Player{}, c.stopErr()
+			case <-ctx.Done():
+				return defusedivision.Player{}, ctx.Err()
+			}
+		default:
+		}
+		select {
+		case <-s.hello:
+			c.mu.Lock()
+			player := c.player
+			c.mu.Unlock()
+			c.Name = player.Name
+			if len(player.Field.Selected) == 2 {
+				c.X, c.Y = player.Field.Selected[0], player.Field.Selected[1]
+			}
+			return player, nil
+		case <-s.lost:
+		case <-c.stopped:
+			return defusedivision.Player{}, c.stopErr()
+		case <-ctx.Done():
+			return defusedivision.Player{}, ctx.Err()
+		}
+	}
+}
+
+// Resync waits until the client is connected, knows its player and has been
+// sent a state, then returns the player as of that state, so that a game can
+// continue after the connection was lost.
+func (c *Client) Resync(ctx context.Context) (defusedivision.Player, error) {
+	for {
+		if _, err := c.Player(ctx); err != nil {
+			return defusedivision.Player{}, err
+		}
+		s := c.current()
+		select {
+		case <-s.stated:
+		case <-s.lost:
+			continue
+		case <-c.stopped:
+			return defusedivision.Player{}, c.stopErr()
+		case <-ctx.Done():
+			return defusedivision.Player{}, ctx.Err()
+		}
+		// s may be a newer session than the one Player waited for
+		player, err := c.Player(ctx)
+		if err != nil {
+			return player, err
+		}
+		if latest, ok := c.State().Players[player.Name]; ok {
+			player = latest
+		}
+		c.Living = player.Living
+		return player, nil
 	}
-	return &rv, nil
 }
 
-// NetReader accepts a Client and reads byte-sequence-delimited gzipped messages from
-// that Clients Connection, placing the uncompressed contents of each message
-// into the "Msgs" channel on the provided Client struct. It will repeat this
-// process, doing this forever until an error occurs/the Connection closes.
-func NetReader(client *Client) {
-	buf := []byte{}
-	tmp := make([]byte, 50)
+// State returns the last state sent by the server.
+func (c *Client) State() defusedivision.State {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state
+}
+
+func (c *Client) current() *session {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.session
+}
+
+// run reads from each session in turn, reconnecting whenever a session is
+// lost, until the client is closed or can't reconnect.
+func (c *Client) run(s *session) {
+	defer c.reading.Done()
+	defer close(c.stopped)
 	for {
-		n, err := client.Connection.Read(tmp)
-		if n == 0 || err != nil {
+		s.err = c.read(s)
+		close(s.lost)
+		next, err := c.reconnect(s.err)
+		if err != nil {
+			c.readErr = err
+			return
+		}
+		close(s.next)
+		s = next
+	}
+}
+
+// reconnect opens a new session once a session was lost because of lostErr,
+// retrying with exponential backoff. It returns lostErr if the client can't
+// reconnect at all.
+func (c *Client) reconnect(lostErr error) (*session, error) {
+	if c.closed() {
+		return nil, ErrClosed
+	}
+	if c.dial == nil || c.Reconnects <= 0 {
+		return nil, lostErr
+	}
+	backoff := c.Backoff
+	err := lostErr
+	for attempt := 0; attempt < c.Reconnects; attempt++ {
+		if c.Log != nil {
+			fmt.Fprintf(c.Log, "reconnecting in %v after: %v\n", backoff, err)
+		}
+		select {
+		case <-time.After(backoff):
+		case <-c.done:
+			return nil, ErrClosed
+		}
+		if backoff *= 2; c.MaxBackoff > 0 && backoff > c.MaxBackoff {
+			backoff = c.MaxBackoff
+		}
+		var conn net.Conn
+		conn, err = c.redial()
+		if err != nil {
+			continue
+		}
+		c.mu.Lock()
+		if c.closed() {
+			c.mu.Unlock()
+			conn.Close()
+			return nil, ErrClosed
+		}
+		c.session = newSession(conn)
+		c.mu.Unlock()
+		return c.session, nil
+	}
+	return nil, fmt.Errorf("gave up reconnecting after %d attempts: %v", c.Reconnects, err)
+}
+
+// redial makes one attempt to connect, cancelled by Close.
+func (c *Client) redial() (net.Conn, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if c.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+	go func() {
+		select {
+		case <-c.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return c.dial(ctx)
+}
+
+func (c *Client) closed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// read reads messages from the session and dispatches each one, until the
+// connection fails or the Client is closed.
+func (c *Client) read(s *session) error {
+	dec := protocol.NewDecoder(s.conn)
+	for {
+		data, err := dec.ReadMessage()
+		var bad *protocol.MessageError
+		if errors.As(err, &bad) {
 			q.Q(err)
-			break
+			continue
 		}
-		// We definitely have at least one message, now to process that one
-		// message.
-		//if bytes.Contains(tmp[:n], []byte{'\x00', '\x01', '\x00'}) {
-		// possibleBuf is buffer of everything received after last msg
-		possibleBuf := []byte{}
-		possibleBuf = append(possibleBuf, buf...)
-		possibleBuf = append(possibleBuf, tmp[:n]...)
-		if bytes.Contains(possibleBuf, []byte{'\x00', '\x01', '\x00'}) {
-			msgs := bytes.Split(possibleBuf, []byte{'\x00', '\x01', '\x00'})
-
-			// Set buf as the beginning of the as-yet incomplete message, which
-			// may be an empty slice
-			buf = msgs[len(msgs)-1]
-			for _, m := range msgs[:len(msgs)-1] {
-				gzr, err := gzip.NewReader(bytes.NewReader(m))
-				if err != nil {
-					panic(err)
-					err = nil
-					continue
-				}
-				err = gzr.Close() // close gzr to fully read until EOF
-				if err != nil {
-					panic(err)
-				}
-				ungzipped, err := ioutil.ReadAll(gzr)
-				if err != nil {
-					panic(err)
-					err = nil
-					continue
-				}
-				client.Msgs <- ungzipped
+		if err != nil {
+			if c.closed() {
+				return ErrClosed
 			}
+			return err
+		}
+		q.Q(string(data))
+		msg, err := defusedivision.DecodeMessage(data)
+		if err != nil {
+			// a message this client doesn't understand can't be the
+			// confirmation of anything it sent
+			q.Q(err)
+			continue
+		}
+		c.dispatch(s, msg)
+	}
+}
+
+// dispatch records what msg says about the game, hands it to every waiter it
+// confirms, then calls the handlers of its kind.
+func (c *Client) dispatch(s *session, msg defusedivision.Message) {
+	c.mu.Lock()
+	switch m := msg.(type) {
+	case defusedivision.PlayerMsg:
+		if !s.greeted {
+			s.greeted = true
+			c.player = m.Player
+			c.name = m.Name
+			// a state from an earlier session may be out of date
+			c.state = defusedivision.State{}
+			close(s.hello)
+		}
+	case defusedivision.NewStateMsg:
+		c.state = m.State
+		if s.greeted && !s.hasState {
+			s.hasState = true
+			close(s.stated)
+		}
+	}
+	waiting := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.session == s && w.match(msg) {
+			w.reply <- msg
 		} else {
-			buf = append(buf, tmp[:n]...)
+			waiting = append(waiting, w)
 		}
+	}
+	c.waiters = waiting
+	handlers := append([]func(defusedivision.Message){}, c.handlers[msg.Kind()]...)
+	c.mu.Unlock()
 
+	for _, f := range handlers {
+		f(msg)
 	}
 }
 
-// move* functions send a command to client, then consume the
-// corresponding confirmation message
-func (c *Client) MoveUp() error {
-	err := c.Send("UP")
-	c.Y = c.Y - 1
-	// a confirmation is sent back after the movement is recieved. Discard it
-	c.Message()
-	return err
+// expect registers a waiter for the first later message matching match. It
+// must be called before sending the command, so that the confirmation can't
+// arrive before anything waits for it.
+func (c *Client) expect(match func(defusedivision.Message) bool) *waiter {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	w := &waiter{
+		match:   match,
+		reply:   make(chan defusedivision.Message, 1),
+		lost:    c.session.lost,
+		session: c.session,
+	}
+	c.waiters = append(c.waiters, w)
+	return w
 }
-func (c *Client) MoveDown() error {
-	err := c.Send("DOWN")
-	c.Y = c.Y + 1
-	c.Message()
-	return err
+
+// forget stops waiting on w, if it is still waiting.
+func (c *Client) forget(w *waiter) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for idx, other := range c.waiters {
+		if other == w {
+			c.waiters = append(c.waiters[:idx], c.waiters[idx+1:]...)
+			return
+		}
+	}
 }
-func (c *Client) MoveLeft() error {
-	err := c.Send("LEFT")
-	c.X = c.X - 1
-	c.Message()
-	return err
+
+// await waits for the message confirming w, for at most Timeout.
+func (c *Client) await(ctx context.Context, w *waiter) (defusedivision.Message, error) {
+	defer c.forget(w)
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+	select {
+	case msg := <-w.reply:
+		return msg, nil
+	case <-w.lost:
+		// the confirmation is handed over before the connection is
+		// marked lost, and the select might not have seen it yet
+		select {
+		case msg := <-w.reply:
+			return msg, nil
+		default:
+		}
+		if c.closed() {
+			return nil, ErrClosed
+		}
+		return nil, fmt.Errorf("%w: %v", ErrDisconnected, w.session.err)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
 }
-func (c *Client) MoveRight() error {
-	err := c.Send("RIGHT")
-	c.X = c.X + 1
-	c.Message()
-	return err
+
+func (c *Client) stopErr() error {
+	return fmt.Errorf("connection closed: %w", c.readErr)
 }
 
-// moves the client to the given X,Y coordinates
-func (c *Client) MoveToXY(X int, Y int) error {
-	// move up to cell
-	for c.Y > Y {
-		c.MoveUp()
-		time.Sleep(20 * time.Millisecond)
-	}
-	// move down to cell
-	for c.Y < Y {
-		c.MoveDown()
-		time.Sleep(20 * time.Millisecond)
+// command sends toSend, then waits for the message matching match.
+func (c *Client) command(ctx context.Context, toSend interface{}, match func(defusedivision.Message) bool) (defusedivision.Message, error) {
+	w := c.expect(match)
+	if err := c.send(ctx, w.session, toSend); err != nil {
+		c.forget(w)
+		return nil, err
 	}
-	// move left to cell
-	for c.X > X {
-		c.MoveLeft()
-		time.Sleep(20 * time.Millisecond)
+	return c.await(ctx, w)
+}
+
+// currentName returns the name of this client's player, as last introduced by
+// the server.
+func (c *Client) currentName() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.name
+}
+
+// selects returns a match for the update-selected moving this client's cursor
+// to xy.
+func (c *Client) selects(xy [2]int) func(defusedivision.Message) bool {
+	name := c.currentName()
+	return func(msg defusedivision.Message) bool {
+		m, ok := msg.(defusedivision.UpdateSelectedMsg)
+		return ok && m.Name == name && m.Selected == xy
 	}
-	// move right to cell
-	for c.X < X {
-		c.MoveRight()
-		time.Sleep(20 * time.Millisecond)
+}
+
+// changes returns a match for a new-state in which this client's player
+// satisfies changed.
+func (c *Client) changes(changed func(player defusedivision.Player) bool) func(defusedivision.Message) bool {
+	name := c.currentName()
+	return func(msg defusedivision.Message) bool {
+		m, ok := msg.(defusedivision.NewStateMsg)
+		if !ok {
+			return false
+		}
+		player, ok := m.Players[name]
+		return ok && changed(player)
 	}
-	return nil
 }
 
-// moves to, then probes the given coordinates. Before it does, it also
-// flags the probing spot in order to verify its location
-func (c *Client) ProbeXY(X int, Y int) (defusedivision.State, defusedivision.Player, error) {
-	c.MoveToXY(X, Y)
-	time.Sleep(50 * time.Millisecond)
-	c.Send("PROBE")
-	time.Sleep(50 * time.Millisecond)
-	msg := c.Message()
-	state := msg.(defusedivision.State)
-	player := state.Players[c.Name]
-	x := player.Field.Selected[0]
-	y := player.Field.Selected[1]
-	// update client's location (it has never been different before, but just
-	// in case)
-	c.X = x
-	c.Y = y
-	c.Living = player.Living
-	return state, player, nil
+// move* functions send a command to client, then wait for the update-selected
+// confirming the move
+func (c *Client) MoveUp(ctx context.Context) error {
+	return c.move(ctx, "UP", 0, -1)
+}
+func (c *Client) MoveDown(ctx context.Context) error {
+	return c.move(ctx, "DOWN", 0, 1)
+}
+func (c *Client) MoveLeft(ctx context.Context) error {
+	return c.move(ctx, "LEFT", -1, 0)
+}
+func (c *Client) MoveRight(ctx context.Context) error {
+	return c.move(ctx, "RIGHT", 1, 0)
 }
 
-func (c *Client) FlagXY(X int, Y int) error {
-	c.MoveToXY(X, Y)
-	time.Sleep(50 * time.Millisecond)
-	c.Send("FLAG")
-	time.Sleep(50 * time.Millisecond)
-	msg := c.Message()
-	state := msg.(defusedivision.State)
-	player := state.Players[c.Name]
-	x := player.Field.Selected[0]
-	y := player.Field.Selected[1]
-	// update client's location (it has never been different before, but just
-	// in case)
-	c.X = x
-	c.Y = y
-	c.Living = player.Living
+func (c *Client) move(ctx context.Context, command string, dx int, dy int) error {
+	to := [2]int{c.X + dx, c.Y + dy}
+	if _, err := c.command(ctx, command, c.selects(to)); err != nil {
+		return err
+	}
+	c.X, c.Y = to[0], to[1]
 	return nil
 }
 
-func (c *Client) Send(toSend interface{}) error {
-	data, err := json.Marshal(toSend)
-	if err != nil {
-		return err
+// moves the client to the given X,Y coordinates, either in one step with
+// SelectCommand or one cell at a time along the shortest path
+func (c *Client) MoveToXY(ctx context.Context, X int, Y int) error {
+	if c.SelectCommand != "" {
+		if c.X == X && c.Y == Y {
+			return nil
+		}
+		toSend := map[string][]int{c.SelectCommand: {X, Y}}
+		if _, err := c.command(ctx, toSend, c.selects([2]int{X, Y})); err != nil {
+			return err
+		}
+		c.X = X
+		c.Y = Y
+		return nil
 	}
+	steps := []struct {
+		more func() bool
+		move func(context.Context) error
+	}{
+		{func() bool { return c.Y > Y }, c.MoveUp},
+		{func() bool { return c.Y < Y }, c.MoveDown},
+		{func() bool { return c.X > X }, c.MoveLeft},
+		{func() bool { return c.X < X }, c.MoveRight},
+	}
+	for _, step := range steps {
+		for step.more() {
+			if err := step.move(ctx); err != nil {
+				return err
+			}
+			if err := pause(ctx, 20*time.Millisecond); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
 
-	var packet []byte
-	tmp := bytes.NewBuffer(packet)
+// moves to, then probes the given coordinates, and waits for the new state in
+// which the cell is probed.
+func (c *Client) ProbeXY(ctx context.Context, X int, Y int) (defusedivision.State, defusedivision.Player, error) {
+	xy := [2]int{X, Y}
+	return c.act(ctx, xy, "PROBE", func(before, after defusedivision.Player) bool {
+		cell := cellAt(after.Field, xy)
+		return (cell != nil && cell.Probed) || !after.Living || after.Field.Victory
+	})
+}
 
-	w := gzip.NewWriter(tmp)
-	if _, err := w.Write(data); err != nil {
-		return err
+// moves to, then toggles the flag on the given coordinates, and waits for the
+// new state in which the flag has changed.
+func (c *Client) FlagXY(ctx context.Context, X int, Y int) error {
+	xy := [2]int{X, Y}
+	_, _, err := c.act(ctx, xy, "FLAG", func(before, after defusedivision.Player) bool {
+		was := cellAt(before.Field, xy)
+		cell := cellAt(after.Field, xy)
+		return cell != nil && cell.Flagged != (was != nil && was.Flagged)
+	})
+	return err
+}
+
+// ChordXY probes every unprobed, unflagged neighbor of the probed cell at X,Y,
+// if it has as many flagged neighbors as it touches mines. DefuseDivision has
+// no command for this, so unless ChordCommand names one the chord is played
+// as a probe of each neighbor, going by the board the server sent last.
+func (c *Client) ChordXY(ctx context.Context, X int, Y int) (defusedivision.State, defusedivision.Player, error) {
+	if c.ChordCommand != "" {
+		// a chord confirms itself by opening one of the neighbors, like a
+		// probe does
+		return c.act(ctx, [2]int{X, Y}, c.ChordCommand, func(before, after defusedivision.Player) bool {
+			if !after.Living || after.Field.Victory {
+				return true
+			}
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					xy := [2]int{X + dx, Y + dy}
+					was, cell := cellAt(before.Field, xy), cellAt(after.Field, xy)
+					if xy == [2]int{X, Y} || cell == nil {
+						continue
+					}
+					// without an earlier board, any open neighbor
+					// will do
+					if cell.Probed && (was == nil || !was.Probed && !was.Flagged) {
+						return true
+					}
+				}
+			}
+			return false
+		})
 	}
-	err = w.Close()
-	if err != nil {
-		return err
+	state := c.State()
+	player := state.Players[c.currentName()]
+	cells := map[[2]int]*defusedivision.Cell{}
+	for _, cell := range player.Field.Cells {
+		cells[[2]int{cell.X, cell.Y}] = cell
 	}
-	_, err = tmp.Write([]byte{'\x00', '\x01', '\x00'})
-	if err != nil {
-		return err
+	center, ok := cells[[2]int{X, Y}]
+	if !ok || !center.Probed {
+		return state, player, nil
+	}
+	touching, flags := 0, 0
+	for _, mine := range center.Neighbors {
+		if mine != nil && *mine {
+			touching += 1
+		}
+	}
+	neighbors := [][2]int{}
+	for dy := -1; dy <= 1; dy++ {
+		for dx := -1; dx <= 1; dx++ {
+			neighbor, ok := cells[[2]int{X + dx, Y + dy}]
+			if (dx == 0 && dy == 0) || !ok {
+				continue
+			}
+			if neighbor.Flagged {
+				flags += 1
+			} else if !neighbor.Probed {
+				neighbors = append(neighbors, [2]int{neighbor.X, neighbor.Y})
+			}
+		}
+	}
+	if flags != touching {
+		return state, player, nil
+	}
+	for _, xy := range neighbors {
+		// an earlier probe may have opened this neighbor already
+		if cell := cellAt(player.Field, xy); cell != nil && cell.Probed {
+			continue
+		}
+		var err error
+		state, player, err = c.ProbeXY(ctx, xy[0], xy[1])
+		if err != nil || !player.Living {
+			return state, player, err
+		}
+	}
+	return state, player, nil
+}
+
+// act moves to xy, sends command there, and returns the first new state in
+// which this player, compared to before the command, satisfies confirms.
+// New states sent because of other players are passed over.
+func (c *Client) act(ctx context.Context, xy [2]int, command string, confirms func(before, after defusedivision.Player) bool) (defusedivision.State, defusedivision.Player, error) {
+	if err := c.MoveToXY(ctx, xy[0], xy[1]); err != nil {
+		return defusedivision.State{}, defusedivision.Player{}, err
+	}
+	if err := pause(ctx, 50*time.Millisecond); err != nil {
+		return defusedivision.State{}, defusedivision.Player{}, err
 	}
-	_, err = tmp.WriteTo(c.Connection)
+	before := c.State().Players[c.currentName()]
+	msg, err := c.command(ctx, command, c.changes(func(after defusedivision.Player) bool {
+		return confirms(before, after)
+	}))
 	if err != nil {
-		return err
+		return defusedivision.State{}, defusedivision.Player{}, fmt.Errorf("waiting for %s to be confirmed: %w", command, err)
+	}
+	state := msg.(defusedivision.NewStateMsg).State
+	player := state.Players[c.currentName()]
+	if len(player.Field.Selected) == 2 {
+		// update client's location (it has never been different before,
+		// but just in case)
+		c.X = player.Field.Selected[0]
+		c.Y = player.Field.Selected[1]
+	}
+	c.Living = player.Living
+	return state, player, nil
+}
+
+func cellAt(mf defusedivision.Minefield, xy [2]int) *defusedivision.Cell {
+	for _, cell := range mf.Cells {
+		if cell.X == xy[0] && cell.Y == xy[1] {
+			return cell
+		}
 	}
 	return nil
 }
 
-// Method Message will block until it returns the next message from the server.
-// That return value is an interface of either type Player, type State, or a
-// slice of interfaces (an 'update-selected' message). If a timeout occurs,
-// returns nil.
-func (c *Client) Message() interface{} {
-	// Try to read a message for 50 ms, then time out
-	var msg []byte
+// pause waits for d, or until ctx is done.
+func pause(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
 	select {
-	case msg = <-c.Msgs:
-	case <-time.After(500 * time.Millisecond):
+	case <-t.C:
 		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
+}
+
+// Send encodes toSend as JSON and writes it to the server as one message. The
+// write is abandoned at the deadline of ctx.
+func (c *Client) Send(ctx context.Context, toSend interface{}) error {
+	return c.send(ctx, c.current(), toSend)
+}
 
-	q.Q(string(msg))
-	// Check if the server sent a 'configuration' message, a Player object
-	// about ourselves.
-	var player defusedivision.Player
-	var err error
-	if err = json.Unmarshal(msg, &player); err == nil {
-		c.Name = player.Name
-		return player
+func (c *Client) send(ctx context.Context, s *session, toSend interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if c.closed() {
+		return ErrClosed
 	}
-	// Implicitly there was an error, because the message was not a player
-	// object. So now, we test the other two cases, both of which are lists.
-	var items []interface{}
-	err = json.Unmarshal(msg, &items)
+	data, err := json.Marshal(toSend)
 	if err != nil {
-		// We don't know what the heck the structure of this message could be
-		// if it's not a list of stuff!
-		panic(err)
+		return err
 	}
-
-	if first, ok := items[0].(string); ok {
-		if first == "new-state" {
-			thebits, err := json.Marshal(items[1])
-			if err != nil {
-				panic("BUT WE JUST GOT THIS FROM JSON, HOW CNA WE NOT MARSHAL IT AGAIN?!?!")
-			}
-			var state defusedivision.State
-			json.Unmarshal(thebits, &state)
-			return state
-		} else if first == "update-selected" {
-			return items[1]
-		} else {
-			panic("HOW COULD IT NOT BE ONE OF THOSE TWO!?!")
-		}
-	} else {
-		panic("WHAT ELSE CAN THE FIRST BE IF NOT A STRING?!?!?!")
+	// the zero deadline, when ctx has none, clears any earlier one
+	deadline, _ := ctx.Deadline()
+	if err := s.conn.SetWriteDeadline(deadline); err != nil {
+		return fmt.Errorf("%w: %v", ErrDisconnected, err)
+	}
+	err = s.enc.WriteMessage(data)
+	if err == nil || errors.Is(err, protocol.ErrTooLarge) {
+		return err
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
 	}
+	return fmt.Errorf("%w: %v", ErrDisconnected, err)
 }
@@ -0,0 +1,381 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lelandbatey/minesweeper-solver/defusedivision"
+	"github.com/lelandbatey/minesweeper-solver/fakeserver"
+)
+
+// player returns a player named name on a 3x3 board, with edit applied to
+// each cell.
+func player(name string, edit func(cell *defusedivision.Cell)) defusedivision.Player {
+	mf := defusedivision.Minefield{Width: 3, Height: 3, Minecount: 1, Selected: []int{0, 0}}
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 3; x++ {
+			cell := &defusedivision.Cell{Contents: "   ", X: x, Y: y, Neighbors: map[string]*bool{}}
+			if edit != nil {
+				edit(cell)
+			}
+			mf.Cells = append(mf.Cells, cell)
+		}
+	}
+	return defusedivision.Player{Name: name, Living: true, Field: mf}
+}
+
+// state returns a new-state holding players.
+func state(players ...defusedivision.Player) defusedivision.NewStateMsg {
+	msg := defusedivision.NewStateMsg{State: defusedivision.State{Ready: true, Players: map[string]defusedivision.Player{}}}
+	for _, p := range players {
+		msg.Players[p.Name] = p
+	}
+	return msg
+}
+
+// at returns an edit marking the cell at xy with mark.
+func at(xy [2]int, mark func(cell *defusedivision.Cell)) func(cell *defusedivision.Cell) {
+	return func(cell *defusedivision.Cell) {
+		if cell.X == xy[0] && cell.Y == xy[1] {
+			mark(cell)
+		}
+	}
+}
+
+func probe(cell *defusedivision.Cell) { cell.Probed = true }
+func flag(cell *defusedivision.Cell)  { cell.Flagged = true }
+
+func selected(name string, x, y int) defusedivision.UpdateSelectedMsg {
+	return defusedivision.UpdateSelectedMsg{Name: name, Selected: [2]int{x, y}}
+}
+
+// start runs script after introducing the player "me", and returns a client
+// of it which knows its player.
+func start(t *testing.T, script ...fakeserver.Step) (*Client, *fakeserver.Server) {
+	t.Helper()
+	script = append([]fakeserver.Step{fakeserver.Send(defusedivision.PlayerMsg{Player: player("me", nil)})}, script...)
+	s := fakeserver.Start(script...)
+	c := NewConn(s.Client)
+	t.Cleanup(func() {
+		c.Close()
+		s.Close()
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := c.Player(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return c, s
+}
+
+func TestPlayer(t *testing.T) {
+	c, _ := start(t)
+	if c.Name != "me" {
+		t.Errorf("client is named %q, want %q", c.Name, "me")
+	}
+}
+
+func TestMoveToXYIgnoresOtherPlayers(t *testing.T) {
+	c, s := start(t,
+		fakeserver.Expect("DOWN"),
+		fakeserver.Send(selected("other", 0, 1), selected("me", 0, 1)),
+		fakeserver.Expect("RIGHT"),
+		fakeserver.Split(2, selected("me", 1, 1)),
+	)
+	if err := c.MoveToXY(context.Background(), 1, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if c.X != 1 || c.Y != 1 {
+		t.Errorf("client is at (%d, %d), want (1, 1)", c.X, c.Y)
+	}
+}
+
+func TestMoveToXYSelectCommand(t *testing.T) {
+	c, s := start(t,
+		fakeserver.Expect(map[string][]int{"SELECT": {2, 1}}),
+		fakeserver.Send(selected("me", 2, 1)),
+	)
+	c.SelectCommand = "SELECT"
+	if err := c.MoveToXY(context.Background(), 2, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Wait(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestChordCommandWaitsForANeighbor(t *testing.T) {
+	marked := func(cell *defusedivision.Cell) {
+		at([2]int{1, 1}, probe)(cell)
+		at([2]int{0, 0}, flag)(cell)
+	}
+	board := player("me", marked)
+	// the cursor catching up is no confirmation of the chord
+	moved := player("me", marked)
+	moved.Field.Selected = []int{1, 1}
+	chorded := player("me", func(cell *defusedivision.Cell) {
+		marked(cell)
+		at([2]int{2, 2}, probe)(cell)
+	})
+	chorded.Field.Selected = []int{1, 1}
+	c, s := start(t,
+		fakeserver.Send(state(board)),
+		fakeserver.Expect(map[string][]int{"SELECT": {1, 1}}),
+		fakeserver.Send(selected("me", 1, 1)),
+		fakeserver.Expect("CHORD"),
+		fakeserver.Send(state(moved)),
+		fakeserver.Send(state(chorded)),
+	)
+	c.SelectCommand = "SELECT"
+	c.ChordCommand = "CHORD"
+	_, p, err := c.ChordXY(context.Background(), 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if cell := cellAt(p.Field, [2]int{2, 2}); cell == nil || !cell.Probed {
+		t.Errorf("ChordXY returned a state where (2, 2) isn't probed")
+	}
+}
+
+func TestProbeXYWaitsForItsState(t *testing.T) {
+	c, s := start(t,
+		fakeserver.Expect("PROBE"),
+		// another player's probe arrives first
+		fakeserver.Send(state(player("me", nil), player("other", at([2]int{0, 0}, probe)))),
+		fakeserver.Split(5, state(player("me", at([2]int{0, 0}, probe)), player("other", at([2]int{0, 0}, probe)))),
+	)
+	_, p, err := c.ProbeXY(context.Background(), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if !p.Field.Cells[0].Probed {
+		t.Errorf("ProbeXY returned a state where (0, 0) isn't probed")
+	}
+}
+
+func TestFlagXYSkipsCorruptMessages(t *testing.T) {
+	c, s := start(t,
+		fakeserver.Expect("FLAG"),
+		fakeserver.Corrupt(),
+		fakeserver.Raw([]byte("not gzip\x00\x01\x00")),
+		fakeserver.Send(state(player("me", at([2]int{0, 0}, flag)))),
+	)
+	if err := c.FlagXY(context.Background(), 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Wait(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProbeXYTimeout(t *testing.T) {
+	c, _ := start(t,
+		fakeserver.Expect("PROBE"),
+		fakeserver.Delay(500*time.Millisecond),
+		fakeserver.Send(state(player("me", at([2]int{0, 0}, probe)))),
+	)
+	c.Timeout = 50 * time.Millisecond
+	_, _, err := c.ProbeXY(context.Background(), 0, 0)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestProbeXYDisconnect(t *testing.T) {
+	c, _ := start(t,
+		fakeserver.Expect("PROBE"),
+		fakeserver.Disconnect(),
+	)
+	begin := time.Now()
+	if _, _, err := c.ProbeXY(context.Background(), 0, 0); err == nil {
+		t.Errorf("ProbeXY succeeded after the server disconnected")
+	}
+	if waited := time.Since(begin); waited > c.Timeout/2 {
+		t.Errorf("waited %v to notice the disconnect", waited)
+	}
+}
+
+func TestProbeXYConfirmedBeforeDisconnect(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		c, _ := start(t,
+			fakeserver.Expect("PROBE"),
+			fakeserver.Send(state(player("me", at([2]int{0, 0}, probe)))),
+			fakeserver.Disconnect(),
+		)
+		if _, _, err := c.ProbeXY(context.Background(), 0, 0); err != nil {
+			t.Fatalf("ProbeXY failed after its state arrived: %v", err)
+		}
+	}
+}
+
+func TestCloseStopsReader(t *testing.T) {
+	c, _ := start(t)
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := c.ProbeXY(context.Background(), 0, 0); !errors.Is(err, ErrClosed) {
+		t.Errorf("got %v, want %v", err, ErrClosed)
+	}
+	if err := c.Close(); err != ErrClosed {
+		t.Errorf("closing twice got %v, want %v", err, ErrClosed)
+	}
+}
+
+func TestHandle(t *testing.T) {
+	c, s := start(t,
+		fakeserver.Expect("UP"),
+		fakeserver.Send(selected("other", 2, 2)),
+	)
+	moves := make(chan defusedivision.UpdateSelectedMsg, 1)
+	c.Handle(defusedivision.KindUpdateSelected, func(msg defusedivision.Message) {
+		moves <- msg.(defusedivision.UpdateSelectedMsg)
+	})
+	// the move is sent without waiting for its confirmation, which never
+	// comes
+	if err := c.Send(context.Background(), "UP"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-moves:
+		if got != selected("other", 2, 2) {
+			t.Errorf("handled %+v", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("handler wasn't called")
+	}
+	if err := s.Wait(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// dialer returns a dial function connecting to a new fake server for each
+// script in turn, failing once they run out.
+func dialer(t *testing.T, scripts ...[]fakeserver.Step) func(context.Context) (net.Conn, error) {
+	var mu sync.Mutex
+	return func(ctx context.Context) (net.Conn, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if len(scripts) == 0 {
+			return nil, errors.New("connection refused")
+		}
+		s := fakeserver.Start(scripts[0]...)
+		scripts = scripts[1:]
+		t.Cleanup(func() { s.Close() })
+		return s.Client, nil
+	}
+}
+
+func introduce(p defusedivision.Player) fakeserver.Step {
+	return fakeserver.Send(defusedivision.PlayerMsg{Player: p})
+}
+
+func TestReconnectResyncs(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resumed := player("me again", at([2]int{1, 1}, probe))
+	resumed.Field.Selected = []int{1, 1}
+	// the state is newer than the introduction, and has the probe of (2, 2)
+	// too
+	latest := player("me again", func(cell *defusedivision.Cell) {
+		if cell.X == cell.Y && cell.X > 0 {
+			probe(cell)
+		}
+	})
+	latest.Field.Selected = []int{1, 1}
+	c, err := Dial(ctx, dialer(t,
+		[]fakeserver.Step{introduce(player("me", nil)), fakeserver.Expect("PROBE"), fakeserver.Disconnect()},
+		[]fakeserver.Step{introduce(resumed), fakeserver.Delay(20 * time.Millisecond), fakeserver.Send(state(latest))},
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.Backoff = time.Millisecond
+	var log bytes.Buffer
+	c.Log = &log
+	if _, err := c.Player(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := c.ProbeXY(ctx, 0, 0); !errors.Is(err, ErrDisconnected) {
+		t.Fatalf("got %v, want %v", err, ErrDisconnected)
+	}
+	p, err := c.Resync(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Name != "me again" || p.Name != "me again" {
+		t.Errorf("resynced as %q, client named %q", p.Name, c.Name)
+	}
+	if c.X != 1 || c.Y != 1 {
+		t.Errorf("client is at (%d, %d), want (1, 1)", c.X, c.Y)
+	}
+	if cell := cellAt(p.Field, [2]int{1, 1}); cell == nil || !cell.Probed {
+		t.Errorf("resynced board lost the probe at (1, 1)")
+	}
+	if cell := cellAt(p.Field, [2]int{2, 2}); cell == nil || !cell.Probed {
+		t.Errorf("resynced to the introduced board, not the state's")
+	}
+	if !strings.Contains(log.String(), "reconnecting") {
+		t.Errorf("reconnecting wasn't logged: %q", log.String())
+	}
+}
+
+func TestReconnectKeepsConfirmation(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	probed := player("me", at([2]int{0, 0}, probe))
+	for i := 0; i < 20; i++ {
+		c, err := Dial(ctx, dialer(t,
+			[]fakeserver.Step{introduce(player("me", nil)), fakeserver.Expect("PROBE"), fakeserver.Send(state(probed)), fakeserver.Disconnect()},
+			[]fakeserver.Step{introduce(probed), fakeserver.Send(state(probed))},
+		))
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Backoff = time.Millisecond
+		if _, err := c.Player(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := c.ProbeXY(ctx, 0, 0); err != nil {
+			t.Fatalf("ProbeXY failed after its state arrived: %v", err)
+		}
+		c.Close()
+	}
+}
+
+func TestReconnectGivesUp(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, err := Dial(ctx, dialer(t,
+		[]fakeserver.Step{introduce(player("me", nil)), fakeserver.Expect("PROBE"), fakeserver.Disconnect()},
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.Backoff = time.Millisecond
+	c.Reconnects = 3
+	if _, err := c.Player(ctx); err != nil {
+		t.Fatal(err)
+	}
+	c.ProbeXY(ctx, 0, 0)
+	if _, err := c.Resync(ctx); err == nil || ctx.Err() != nil {
+		t.Errorf("Resync got %v, want the client to give up", err)
+	}
+}
@@ -0,0 +1,159 @@
+// Command bench plays many games against local boards with a chosen strategy
+// and reports how well the strategy did on each board size.
+//
+//	bench -games 200 -strategy exact -boards 9x9x10,16x16x40,30x16x99
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lelandbatey/minesweeper-solver/engine"
+	"github.com/lelandbatey/minesweeper-solver/runner"
+	"github.com/lelandbatey/minesweeper-solver/solver"
+)
+
+var (
+	games    = flag.Int("games", 100, "number of games to play on each board")
+	boards   = flag.String("boards", "9x9x10,16x16x40,30x16x99", "comma separated boards to play, as WIDTHxHEIGHTxMINES")
+	strategy = flag.String("strategy", "exact", "strategy to play with: "+strings.Join(solver.StrategyNames(), ", "))
+	seed     = flag.Int64("seed", 1, "seed of the first game on each board; game i uses seed+i")
+	first    = flag.String("first", "safe", "what the ruleset promises about the first probe: any, safe or zero")
+	opening  = flag.String("opening", "auto", "where to probe first: auto, corner, edge or center")
+)
+
+// A board is the size and mine count of the boards played.
+type board struct {
+	width, height, mines int
+}
+
+func (b board) String() string {
+	return fmt.Sprintf("%dx%dx%d", b.width, b.height, b.mines)
+}
+
+// stats accumulates the results of the games played on one board.
+type stats struct {
+	games, wins, errors int
+	guesses, moves      int
+	travel              int
+	thinking            time.Duration
+	// losses counts the games lost by the fraction of safe cells probed
+	// before exploding, in tenths
+	losses [10]int
+}
+
+func (s *stats) add(result runner.Result) {
+	s.games += 1
+	s.guesses += result.Guesses
+	s.moves += result.Moves
+	s.travel += result.Travel
+	s.thinking += result.Thinking
+	if result.Won {
+		s.wins += 1
+		return
+	}
+	decile := int(result.Progress * 10)
+	if decile > 9 {
+		decile = 9
+	}
+	if decile < 0 {
+		decile = 0
+	}
+	s.losses[decile] += 1
+}
+
+func (s *stats) report(b board) {
+	fmt.Printf("%v: won %d of %d (%.1f%%)", b, s.wins, s.games, percent(s.wins, s.games))
+	if s.errors > 0 {
+		fmt.Printf(", %d games failed", s.errors)
+	}
+	fmt.Println()
+	if s.games == 0 {
+		return
+	}
+	fmt.Printf("  mean guesses per game: %.2f\n", float64(s.guesses)/float64(s.games))
+	fmt.Printf("  mean cursor travel:    %.1f\n", float64(s.travel)/float64(s.games))
+	if s.moves > 0 {
+		fmt.Printf("  mean time per move:    %v\n", s.thinking/time.Duration(s.moves))
+	}
+	lost := s.games - s.wins
+	if lost == 0 {
+		return
+	}
+	fmt.Println("  losses by safe cells probed:")
+	for decile, count := range s.losses {
+		fmt.Printf("    %3d%%-%3d%%: %5d (%5.1f%%) %s\n", decile*10, decile*10+10, count,
+			percent(count, lost), strings.Repeat("#", int(percent(count, lost)/2)))
+	}
+}
+
+func percent(n, of int) float64 {
+	if of == 0 {
+		return 0.0
+	}
+	return float64(n) * 100 / float64(of)
+}
+
+func parseBoards(spec string) ([]board, error) {
+	rv := []board{}
+	for _, part := range strings.Split(spec, ",") {
+		b := board{}
+		_, err := fmt.Sscanf(strings.TrimSpace(part), "%dx%dx%d", &b.width, &b.height, &b.mines)
+		if err != nil {
+			return nil, fmt.Errorf("board %q is not WIDTHxHEIGHTxMINES: %v", part, err)
+		}
+		rv = append(rv, b)
+	}
+	return rv, nil
+}
+
+func main() {
+	flag.Parse()
+	strat, ok := solver.Strategies[*strategy]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown strategy %q, expected one of %v\n", *strategy, solver.StrategyNames())
+		os.Exit(2)
+	}
+	bs, err := parseBoards(*boards)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	if _, err := solver.OpeningCell(1, 1, 0, solver.FirstClick(*first), solver.Opening(*opening)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	fmt.Printf("strategy %s, %d games per board, seeds from %d\n", *strategy, *games, *seed)
+	for _, b := range bs {
+		open, err := solver.OpeningCell(b.width, b.height, b.mines, solver.FirstClick(*first), solver.Opening(*opening))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		s := &stats{}
+		for i := 0; i < *games; i++ {
+			g, err := engine.New(b.width, b.height, b.mines, *seed+int64(i))
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(2)
+			}
+			g.ZeroOpening = solver.FirstClick(*first) == solver.FirstClickZero
+			result, err := runner.Play(context.Background(), runner.Local{Game: g}, strat, open, nil)
+			if err != nil {
+				// count the game anyway, so a strategy can't improve its
+				// win rate by failing
+				fmt.Fprintf(os.Stderr, "%v seed %d: %v\n", b, g.Seed(), err)
+				s.errors += 1
+			}
+			s.add(result)
+		}
+		fmt.Printf("opening @ %v\n", open)
+		s.report(b)
+	}
+}
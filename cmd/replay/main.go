@@ -0,0 +1,114 @@
+// Command replay steps through a game recorded with the bot's -record flag,
+// rendering the board before every move. With -rerun it also asks a strategy
+// to decide on each recorded board, and points out where its decisions differ
+// from the recorded ones.
+//
+//	replay -rerun exact -step game.jsonl
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/lelandbatey/minesweeper-solver/recording"
+	"github.com/lelandbatey/minesweeper-solver/solver"
+)
+
+var (
+	rerun = flag.String("rerun", "", "strategy to decide each recorded board again with: "+strings.Join(solver.StrategyNames(), ", "))
+	step  = flag.Bool("step", false, "wait for enter before each move")
+)
+
+func main() {
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: replay [-rerun strategy] [-step] recording")
+		os.Exit(2)
+	}
+	var strategy solver.Strategy
+	if *rerun != "" {
+		var ok bool
+		if strategy, ok = solver.Strategies[*rerun]; !ok {
+			fmt.Fprintf(os.Stderr, "unknown strategy %q, expected one of %v\n", *rerun, solver.StrategyNames())
+			os.Exit(2)
+		}
+	}
+	f, err := os.Open(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer f.Close()
+	rec, err := recording.Read(f)
+	if rec == nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	// a recording cut short is still replayed as far as it goes
+	if err != nil {
+		defer fmt.Fprintf(os.Stderr, "recording ends early: %v\n", err)
+	}
+
+	h := rec.Header
+	fmt.Printf("%s game %dx%d with %d mines, started %v", h.Strategy, h.Field.Width, h.Field.Height, h.Field.Minecount, h.Started.Format("2006-01-02 15:04:05"))
+	if h.Seed != 0 {
+		fmt.Printf(", seed %d", h.Seed)
+	}
+	fmt.Println()
+
+	enter := bufio.NewScanner(os.Stdin)
+	diverged := 0
+	for idx, round := range rec.Rounds {
+		var probs [][]float64
+		if round.Decision != nil {
+			probs = round.Decision.Probs
+			fmt.Printf("round %d: %d actions decided\n", idx, len(round.Decision.Actions))
+		}
+		if strategy != nil {
+			recorded, decided, err := round.Diverge(strategy)
+			if err != nil {
+				fmt.Printf("  %s failed: %v\n", strategy.Name(), err)
+			}
+			for _, action := range recorded {
+				fmt.Printf("  only recorded: %v\n", action)
+			}
+			for _, action := range decided {
+				fmt.Printf("  only %s: %v\n", strategy.Name(), action)
+			}
+			if len(recorded)+len(decided) > 0 {
+				diverged += 1
+			}
+		}
+		for _, move := range round.Moves {
+			mf, err := recording.Minefield(move.Board, probs)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			fmt.Println(mf.Render())
+			fmt.Printf("%v, answered in %v", move.Action, move.Answered.Sub(move.Sent))
+			if move.Err != "" {
+				fmt.Printf(", failed: %s", move.Err)
+			}
+			fmt.Println()
+			if *step {
+				enter.Scan()
+			}
+		}
+		if round.Resync != nil {
+			fmt.Printf("resynced as %s\n", round.Resync.Player.Name)
+		}
+	}
+	mf, err := recording.Minefield(rec.Board, nil)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Println(mf.Render())
+	if strategy != nil {
+		fmt.Printf("%s decided differently in %d of %d rounds\n", strategy.Name(), diverged, len(rec.Rounds))
+	}
+}
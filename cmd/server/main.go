@@ -0,0 +1,68 @@
+// Command server hosts a DefuseDivision compatible game which the bot, or any
+// DefuseDivision client, can connect to.
+//
+//	server -addr 127.0.0.1:44444 -width 16 -height 16 -mines 40
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/lelandbatey/minesweeper-solver/server"
+)
+
+var (
+	addr   = flag.String("addr", "127.0.0.1:44444", "address to listen on")
+	width  = flag.Int("width", 16, "width of the board")
+	height = flag.Int("height", 16, "height of the board")
+	mines  = flag.Int("mines", 40, "number of mines on the board")
+	seed   = flag.Int64("seed", 0, "seed of the board; 0 picks one from the clock")
+	first  = flag.String("first", "safe", "what the first probe of each player is promised: safe or zero")
+)
+
+func main() {
+	flag.Parse()
+	if *first != "safe" && *first != "zero" {
+		fmt.Fprintf(os.Stderr, "unknown first probe rule %q, expected safe or zero\n", *first)
+		os.Exit(2)
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	s, err := server.New(server.Config{
+		Width:       *width,
+		Height:      *height,
+		Mines:       *mines,
+		Seed:        *seed,
+		ZeroOpening: *first == "zero",
+		Log:         os.Stdout,
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	l, err := net.Listen("tcp", *addr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	go func() {
+		<-interrupts
+		cancel()
+	}()
+
+	fmt.Printf("serving %dx%d with %d mines, seed %d, on %v\n", *width, *height, *mines, *seed, l.Addr())
+	if err := s.Serve(ctx, l); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,129 @@
+package defusedivision
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// A Message is one message sent by a DefuseDivision server. It is always one
+// of PlayerMsg, NewStateMsg or UpdateSelectedMsg.
+//
+// The first message on a connection is a Player, sent as a JSON object, which
+// tells the client which player it is. Every later message is a JSON list of
+// a kind and a payload: ["new-state", State] whenever any player's board
+// changes, and ["update-selected", [name, [x, y]]] whenever a player moves
+// their cursor.
+type Message interface {
+	// Kind is the kind of the message as it is sent, e.g. "new-state".
+	Kind() string
+}
+
+// A PlayerMsg describes the player a connection plays as.
+type PlayerMsg struct {
+	Player
+}
+
+// A NewStateMsg holds the whole state of the game after a change.
+type NewStateMsg struct {
+	State
+}
+
+// An UpdateSelectedMsg reports that a player moved their cursor.
+type UpdateSelectedMsg struct {
+	Name     string
+	Selected [2]int
+}
+
+const (
+	KindPlayer         = "player"
+	KindNewState       = "new-state"
+	KindUpdateSelected = "update-selected"
+)
+
+func (PlayerMsg) Kind() string         { return KindPlayer }
+func (NewStateMsg) Kind() string       { return KindNewState }
+func (UpdateSelectedMsg) Kind() string { return KindUpdateSelected }
+
+// DecodeMessage parses a single message, as sent by a server. Anything which
+// isn't exactly one of the known messages is an error.
+func DecodeMessage(data []byte) (Message, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, errors.New("empty message")
+	}
+	switch data[0] {
+	case '{':
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return nil, fmt.Errorf("decoding player: %v", err)
+		}
+		for _, key := range []string{"name", "living", "minefield"} {
+			if _, ok := fields[key]; !ok {
+				return nil, fmt.Errorf("player message has no %q", key)
+			}
+		}
+		msg := PlayerMsg{}
+		if err := json.Unmarshal(data, &msg.Player); err != nil {
+			return nil, fmt.Errorf("decoding player: %v", err)
+		}
+		return msg, nil
+	case '[':
+	default:
+		return nil, fmt.Errorf("message is neither an object nor a list: %.20q", data)
+	}
+
+	var items []json.RawMessage
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, fmt.Errorf("decoding message: %v", err)
+	}
+	if len(items) != 2 {
+		return nil, fmt.Errorf("message has %d items, expected a kind and a payload", len(items))
+	}
+	var kind string
+	if err := json.Unmarshal(items[0], &kind); err != nil {
+		return nil, fmt.Errorf("decoding message kind: %v", err)
+	}
+	switch kind {
+	case KindNewState:
+		msg := NewStateMsg{}
+		if err := json.Unmarshal(items[1], &msg.State); err != nil {
+			return nil, fmt.Errorf("decoding %s: %v", kind, err)
+		}
+		if msg.Players == nil {
+			return nil, fmt.Errorf("%s message has no players", kind)
+		}
+		return msg, nil
+	case KindUpdateSelected:
+		var payload []json.RawMessage
+		if err := json.Unmarshal(items[1], &payload); err != nil || len(payload) != 2 {
+			return nil, fmt.Errorf("%s payload is not [name, [x, y]]", kind)
+		}
+		msg := UpdateSelectedMsg{}
+		if err := json.Unmarshal(payload[0], &msg.Name); err != nil {
+			return nil, fmt.Errorf("decoding %s name: %v", kind, err)
+		}
+		var selected []int
+		if err := json.Unmarshal(payload[1], &selected); err != nil || len(selected) != 2 {
+			return nil, fmt.Errorf("%s cell is not [x, y]", kind)
+		}
+		msg.Selected = [2]int{selected[0], selected[1]}
+		return msg, nil
+	}
+	return nil, fmt.Errorf("unknown message kind %q", kind)
+}
+
+// EncodeMessage formats msg the way a server sends it, so that DecodeMessage
+// returns it unchanged.
+func EncodeMessage(msg Message) ([]byte, error) {
+	switch m := msg.(type) {
+	case PlayerMsg:
+		return json.Marshal(m.Player)
+	case NewStateMsg:
+		return json.Marshal([]interface{}{m.Kind(), m.State})
+	case UpdateSelectedMsg:
+		return json.Marshal([]interface{}{m.Kind(), []interface{}{m.Name, m.Selected}})
+	}
+	return nil, fmt.Errorf("cannot encode message %T", msg)
+}
@@ -0,0 +1,57 @@
+package defusedivision
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecodeMessage(t *testing.T) {
+	cases := map[string]Message{
+		`{"name": "bot", "living": true, "minefield": {"width": 2, "height": 1, "mine_count": 1, "selected": [0, 0], "cells": []}}`: PlayerMsg{Player{
+			Name:   "bot",
+			Living: true,
+			Field:  Minefield{Width: 2, Height: 1, Minecount: 1, Selected: []int{0, 0}, Cells: []*Cell{}},
+		}},
+		`["new-state", {"ready": true, "players": {}}]`: NewStateMsg{State{Ready: true, Players: map[string]Player{}}},
+		`["update-selected", ["bot", [3, 4]]]`:          UpdateSelectedMsg{Name: "bot", Selected: [2]int{3, 4}},
+	}
+	for data, expected := range cases {
+		msg, err := DecodeMessage([]byte(data))
+		if err != nil {
+			t.Errorf("decoding %s: %v", data, err)
+			continue
+		}
+		if !reflect.DeepEqual(msg, expected) {
+			t.Errorf("decoding %s: expected %#v, found %#v", data, expected, msg)
+		}
+		encoded, err := EncodeMessage(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		again, err := DecodeMessage(encoded)
+		if err != nil || !reflect.DeepEqual(again, msg) {
+			t.Errorf("%s did not survive encoding: %s %v", data, encoded, err)
+		}
+	}
+}
+
+func TestDecodeMessageErrors(t *testing.T) {
+	for _, data := range []string{
+		``,
+		`42`,
+		`{"living": true}`,
+		`["new-state"]`,
+		`["new-state", {"ready": true}]`,
+		`["new-state", {}, {}]`,
+		`[1, {}]`,
+		`["game-over", {}]`,
+		`["update-selected", ["bot"]]`,
+		`["update-selected", ["bot", [1, 2, 3]]]`,
+		`["update-selected", [7, [1, 2]]]`,
+		`["new-state", {"ready": "yes", "players": {}}]`,
+	} {
+		if msg, err := DecodeMessage([]byte(data)); err == nil {
+			t.Errorf("decoding %q: expected an error, found %#v", data, msg)
+		}
+	}
+}
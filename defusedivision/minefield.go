@@ -43,3 +43,20 @@ func (mf *Minefield) Neighborhood(x int, y int) ([][]*Cell, error) {
 	}
 	return cells, nil
 }
+
+// ToggleFlag returns a copy of mf with the flag on the cell at x, y toggled,
+// as a server toggles it when sent "FLAG". Probed cells can't be flagged, and
+// mf itself is left as it was.
+func (mf Minefield) ToggleFlag(x int, y int) Minefield {
+	cells := make([]*Cell, len(mf.Cells))
+	for idx, cell := range mf.Cells {
+		cells[idx] = cell
+		if cell.X == x && cell.Y == y && !cell.Probed {
+			flagged := *cell
+			flagged.Flagged = !flagged.Flagged
+			cells[idx] = &flagged
+		}
+	}
+	mf.Cells = cells
+	return mf
+}
@@ -0,0 +1,351 @@
+// Package engine plays games of minesweeper in-process, without a
+// DefuseDivision server. A Game exposes its board through the same
+// defusedivision structures a server sends, so anything which plays against a
+// server can play against a Game instead.
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+
+	"github.com/lelandbatey/minesweeper-solver/defusedivision"
+)
+
+// A Game is a single game of minesweeper for one player.
+type Game struct {
+	// Name is the name of the player, as reported by Player and State.
+	Name string
+	// ZeroOpening makes the first probe touch no mines, instead of only
+	// being safe, so that it always opens an area. It must be set before
+	// the first probe.
+	ZeroOpening bool
+	width       int
+	height      int
+	minecount   int
+	seed        int64
+	// rng lays out the mines, and moves them away from the first probe
+	rng *rand.Rand
+	// started is set by the first probe, which is always safe
+	started  bool
+	mines    []bool
+	probed   []bool
+	flagged  []bool
+	selected [2]int
+	living   bool
+	victory  bool
+}
+
+// deltas are the offsets of each neighbor, named like the neighbors of a
+// defusedivision.Cell.
+var deltas = map[string][2]int{
+	"N":  {0, -1},
+	"S":  {0, 1},
+	"W":  {-1, 0},
+	"E":  {1, 0},
+	"NW": {-1, -1},
+	"NE": {1, -1},
+	"SW": {-1, 1},
+	"SE": {1, 1},
+}
+
+// New creates a game on a board of the given size holding minecount mines.
+// The mines are laid out at random from seed, so the same seed (and size)
+// always produces the same board. If the first probe lands on a mine, that
+// mine is moved to a free cell chosen at random, also from seed, so that the
+// first probe is always safe and the board is still reproducible. With
+// ZeroOpening set, the mines around the first probe are moved the same way.
+func New(width, height, minecount int, seed int64) (*Game, error) {
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("invalid board size %dx%d", width, height)
+	}
+	if minecount < 0 || minecount >= width*height {
+		return nil, fmt.Errorf("cannot place %d mines on a %dx%d board", minecount, width, height)
+	}
+	g := Game{
+		Name:      "local",
+		width:     width,
+		height:    height,
+		minecount: minecount,
+		seed:      seed,
+		mines:     make([]bool, width*height),
+		probed:    make([]bool, width*height),
+		flagged:   make([]bool, width*height),
+		living:    true,
+		rng:       rand.New(rand.NewSource(seed)),
+	}
+	for _, idx := range g.rng.Perm(width * height)[:minecount] {
+		g.mines[idx] = true
+	}
+	return &g, nil
+}
+
+// Seed returns the seed the board was generated from.
+func (g *Game) Seed() int64 {
+	return g.seed
+}
+
+// Living reports whether the player has not yet probed a mine.
+func (g *Game) Living() bool {
+	return g.living
+}
+
+// Victory reports whether every cell without a mine has been probed.
+func (g *Game) Victory() bool {
+	return g.victory
+}
+
+// Over reports whether the game has been lost or won.
+func (g *Game) Over() bool {
+	return !g.living || g.victory
+}
+
+// Select moves the cursor to the cell at x, y without acting on it.
+func (g *Game) Select(x, y int) error {
+	if _, err := g.index(x, y); err != nil {
+		return err
+	}
+	g.selected = [2]int{x, y}
+	return nil
+}
+
+// Selected returns the cell under the cursor.
+func (g *Game) Selected() [2]int {
+	return g.selected
+}
+
+// Probe reveals the cell at x, y. Probing a mine loses the game; probing a
+// cell touching no mines also reveals its neighbors, spreading across every
+// connected cell touching no mines. Flagged and already probed cells are left
+// alone.
+func (g *Game) Probe(x, y int) error {
+	idx, err := g.index(x, y)
+	if err != nil {
+		return err
+	}
+	if g.Over() {
+		return errors.New("the game is over")
+	}
+	g.selected = [2]int{x, y}
+	if g.flagged[idx] || g.probed[idx] {
+		return nil
+	}
+	if !g.started {
+		g.started = true
+		clear := []int{idx}
+		if g.ZeroOpening {
+			g.eachNeighbor(x, y, func(nx, ny int) {
+				clear = append(clear, nx+ny*g.width)
+			})
+		}
+		g.clearMines(clear)
+		// without room to clear the neighbors, the probe is at least safe
+		g.clearMines([]int{idx})
+	}
+	g.reveal(x, y)
+	return nil
+}
+
+// Flag toggles the flag on the unprobed cell at x, y.
+func (g *Game) Flag(x, y int) error {
+	idx, err := g.index(x, y)
+	if err != nil {
+		return err
+	}
+	if g.Over() {
+		return errors.New("the game is over")
+	}
+	g.selected = [2]int{x, y}
+	if !g.probed[idx] {
+		g.flagged[idx] = !g.flagged[idx]
+	}
+	return nil
+}
+
+// Chord probes every unflagged neighbor of the probed cell at x, y, if it has
+// exactly as many flagged neighbors as it touches mines. Otherwise nothing
+// happens. A wrongly placed flag means a chord will probe a mine.
+func (g *Game) Chord(x, y int) error {
+	idx, err := g.index(x, y)
+	if err != nil {
+		return err
+	}
+	if g.Over() {
+		return errors.New("the game is over")
+	}
+	g.selected = [2]int{x, y}
+	if !g.probed[idx] {
+		return nil
+	}
+	flags := 0
+	g.eachNeighbor(x, y, func(nx, ny int) {
+		if g.flagged[nx+ny*g.width] {
+			flags += 1
+		}
+	})
+	if flags != g.touching(x, y) {
+		return nil
+	}
+	g.eachNeighbor(x, y, func(nx, ny int) {
+		nidx := nx + ny*g.width
+		if g.living && !g.flagged[nidx] && !g.probed[nidx] {
+			g.reveal(nx, ny)
+		}
+	})
+	return nil
+}
+
+// Minefield returns the board as a DefuseDivision server would send it.
+func (g *Game) Minefield() defusedivision.Minefield {
+	mf := defusedivision.Minefield{
+		Height:    g.height,
+		Width:     g.width,
+		Minecount: g.minecount,
+		Selected:  []int{g.selected[0], g.selected[1]},
+		Victory:   g.victory,
+		Cells:     []*defusedivision.Cell{},
+	}
+	for y := 0; y < g.height; y++ {
+		for x := 0; x < g.width; x++ {
+			idx := x + y*g.width
+			contents := "   "
+			if g.mines[idx] {
+				contents = " b "
+			}
+			cell := defusedivision.Cell{
+				Contents:  contents,
+				X:         x,
+				Y:         y,
+				Probed:    g.probed[idx],
+				Flagged:   g.flagged[idx],
+				Neighbors: map[string]*bool{},
+			}
+			for direction, delta := range deltas {
+				nx, ny := x+delta[0], y+delta[1]
+				if nx < 0 || nx >= g.width || ny < 0 || ny >= g.height {
+					cell.Neighbors[direction] = nil
+					continue
+				}
+				mine := g.mines[nx+ny*g.width]
+				cell.Neighbors[direction] = &mine
+			}
+			mf.Cells = append(mf.Cells, &cell)
+		}
+	}
+	return mf
+}
+
+// Player returns the player of this game, as a DefuseDivision server would
+// send it.
+func (g *Game) Player() defusedivision.Player {
+	return defusedivision.Player{
+		Name:   g.Name,
+		Living: g.living,
+		Field:  g.Minefield(),
+	}
+}
+
+// State returns the state of the game, with this game's player as the only
+// player.
+func (g *Game) State() defusedivision.State {
+	return defusedivision.State{
+		Ready:   true,
+		Players: map[string]defusedivision.Player{g.Name: g.Player()},
+	}
+}
+
+func (g *Game) index(x, y int) (int, error) {
+	if x >= g.width || x < 0 {
+		return 0, errors.New("x out of range")
+	}
+	if y >= g.height || y < 0 {
+		return 0, errors.New("y out of range")
+	}
+	return x + y*g.width, nil
+}
+
+// clearMines moves every mine in the cells at indices to a cell chosen at
+// random from those without a mine which aren't one of indices, so that the
+// mines stay uniformly placed over the rest of the board. Mines which have
+// nowhere else to go stay where they are.
+func (g *Game) clearMines(indices []int) {
+	excluded := map[int]bool{}
+	for _, idx := range indices {
+		excluded[idx] = true
+	}
+	free := []int{}
+	for other, mine := range g.mines {
+		if !mine && !excluded[other] {
+			free = append(free, other)
+		}
+	}
+	for _, idx := range indices {
+		if !g.mines[idx] {
+			continue
+		}
+		if len(free) == 0 {
+			return
+		}
+		pick := g.rng.Intn(len(free))
+		g.mines[free[pick]] = true
+		g.mines[idx] = false
+		free[pick] = free[len(free)-1]
+		free = free[:len(free)-1]
+	}
+}
+
+// reveal probes the cell at x, y, flood filling from cells touching no mines,
+// and updates whether the player is living or victorious.
+func (g *Game) reveal(x, y int) {
+	idx := x + y*g.width
+	g.probed[idx] = true
+	if g.mines[idx] {
+		g.living = false
+		return
+	}
+	queue := [][2]int{{x, y}}
+	for len(queue) > 0 {
+		cx, cy := queue[0][0], queue[0][1]
+		queue = queue[1:]
+		if g.touching(cx, cy) != 0 {
+			continue
+		}
+		g.eachNeighbor(cx, cy, func(nx, ny int) {
+			nidx := nx + ny*g.width
+			if g.probed[nidx] || g.flagged[nidx] {
+				return
+			}
+			g.probed[nidx] = true
+			queue = append(queue, [2]int{nx, ny})
+		})
+	}
+	for i := range g.mines {
+		if !g.mines[i] && !g.probed[i] {
+			return
+		}
+	}
+	g.victory = true
+}
+
+// touching returns how many mines the cell at x, y touches.
+func (g *Game) touching(x, y int) int {
+	count := 0
+	g.eachNeighbor(x, y, func(nx, ny int) {
+		if g.mines[nx+ny*g.width] {
+			count += 1
+		}
+	})
+	return count
+}
+
+func (g *Game) eachNeighbor(x, y int, fn func(nx, ny int)) {
+	for dy := -1; dy <= 1; dy++ {
+		for dx := -1; dx <= 1; dx++ {
+			nx, ny := x+dx, y+dy
+			if (dx == 0 && dy == 0) || nx < 0 || nx >= g.width || ny < 0 || ny >= g.height {
+				continue
+			}
+			fn(nx, ny)
+		}
+	}
+}
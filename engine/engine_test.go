@@ -0,0 +1,249 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lelandbatey/minesweeper-solver/solver"
+)
+
+// newWithMines creates a game whose mines are already placed at the given
+// coordinates.
+func newWithMines(t *testing.T, width, height int, mines ...[2]int) *Game {
+	t.Helper()
+	g, err := New(width, height, len(mines), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.mines = make([]bool, width*height)
+	for _, xy := range mines {
+		g.mines[xy[0]+xy[1]*width] = true
+	}
+	g.started = true
+	return g
+}
+
+func TestFirstProbeIsSafe(t *testing.T) {
+	for seed := int64(0); seed < 50; seed++ {
+		g, err := New(3, 3, 8, seed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := g.Probe(1, 1); err != nil {
+			t.Fatal(err)
+		}
+		if !g.Living() {
+			t.Fatalf("first probe exploded")
+		}
+		if !g.Victory() {
+			t.Errorf("probing the only safe cell should win")
+		}
+	}
+}
+
+func TestProbeFloodFill(t *testing.T) {
+	g := newWithMines(t, 4, 3, [2]int{3, 0})
+	if err := g.Probe(0, 2); err != nil {
+		t.Fatal(err)
+	}
+	// the flood fill reveals every safe cell, stopping at the cells
+	// touching the mine
+	for idx, probed := range g.probed {
+		if probed == g.mines[idx] {
+			t.Errorf("cell %d probed=%v mine=%v", idx, probed, g.mines[idx])
+		}
+	}
+	if !g.Victory() {
+		t.Errorf("expected victory once every safe cell is probed")
+	}
+}
+
+func TestProbeMine(t *testing.T) {
+	g := newWithMines(t, 3, 3, [2]int{0, 0})
+	if err := g.Probe(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if g.Living() {
+		t.Errorf("probing a mine should lose the game")
+	}
+	if err := g.Probe(1, 1); err == nil {
+		t.Errorf("expected an error probing after the game is over")
+	}
+}
+
+func TestFlagAndChord(t *testing.T) {
+	g := newWithMines(t, 3, 3, [2]int{0, 0}, [2]int{2, 2})
+	if err := g.Probe(1, 1); err != nil {
+		t.Fatal(err)
+	}
+	if g.probed[0+1*3] {
+		t.Fatalf("probing a 2 should not flood fill")
+	}
+	// with only one flag the chord does nothing
+	g.Flag(0, 0)
+	g.Chord(1, 1)
+	if g.probed[1+0*3] {
+		t.Errorf("chord with too few flags probed a cell")
+	}
+	g.Flag(2, 2)
+	g.Chord(1, 1)
+	if !g.Living() || !g.Victory() {
+		t.Errorf("chord around correctly flagged mines should win, living=%v victory=%v", g.Living(), g.Victory())
+	}
+	// flags toggle
+	g2 := newWithMines(t, 2, 2, [2]int{0, 0})
+	g2.Flag(1, 1)
+	g2.Flag(1, 1)
+	if g2.flagged[3] {
+		t.Errorf("flagging twice should remove the flag")
+	}
+}
+
+func TestMinefieldForSolver(t *testing.T) {
+	g := newWithMines(t, 3, 3, [2]int{0, 0}, [2]int{2, 2})
+	g.Probe(1, 1)
+	g.Flag(0, 0)
+	player := g.Player()
+	if !player.Living || player.Name != g.Name {
+		t.Errorf("unexpected player %+v", player)
+	}
+	mf, err := solver.NewMinefield(player.Field)
+	if err != nil {
+		t.Fatal(err)
+	}
+	center := mf.Cells[1+1*3]
+	if !center.Probed || center.MineTouch != 2 {
+		t.Errorf("center cell probed=%v touching %d, expected a probed 2", center.Probed, center.MineTouch)
+	}
+	if !mf.Cells[0].Flagged {
+		t.Errorf("flag was not sent")
+	}
+	if mf.Minecount != 2 {
+		t.Errorf("mine count %d, expected 2", mf.Minecount)
+	}
+	if sel := player.Field.Selected; sel[0] != 0 || sel[1] != 0 {
+		t.Errorf("selected %v, expected the last flagged cell", sel)
+	}
+}
+
+func TestSeedReproducible(t *testing.T) {
+	play := func(seed int64) *Game {
+		g, err := New(9, 9, 10, seed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := g.Probe(4, 4); err != nil {
+			t.Fatal(err)
+		}
+		return g
+	}
+	a, b := play(42), play(42)
+	if !reflect.DeepEqual(a.mines, b.mines) || !reflect.DeepEqual(a.probed, b.probed) {
+		t.Errorf("the same seed produced different games")
+	}
+	if a.Seed() != 42 {
+		t.Errorf("seed %d, expected 42", a.Seed())
+	}
+	if c := play(43); reflect.DeepEqual(a.mines, c.mines) {
+		t.Errorf("different seeds produced the same board")
+	}
+}
+
+func TestFirstProbeMovesMine(t *testing.T) {
+	// find a seed whose board has a mine in the corner
+	for seed := int64(0); seed < 1000; seed++ {
+		g, err := New(4, 4, 5, seed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !g.mines[15] {
+			continue
+		}
+		before := append([]bool{}, g.mines...)
+		g.Probe(3, 3)
+		if !g.Living() {
+			t.Fatalf("first probe exploded")
+		}
+		moved := 0
+		for idx := range before {
+			if before[idx] != g.mines[idx] {
+				moved += 1
+			}
+		}
+		if moved != 2 {
+			t.Errorf("expected exactly one mine to move, %d cells changed", moved)
+		}
+		return
+	}
+	t.Fatalf("no seed put a mine in the corner")
+}
+
+func TestMovedMinesAreSpreadOut(t *testing.T) {
+	// mines moved away from an opening in the bottom right corner should
+	// land anywhere, not only in the top left
+	moved, topLeft := 0, 0
+	for seed := int64(0); seed < 500; seed++ {
+		g, err := New(9, 9, 10, seed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		g.ZeroOpening = true
+		before := append([]bool{}, g.mines...)
+		g.Probe(8, 8)
+		for idx, mine := range g.mines {
+			if mine && !before[idx] {
+				moved += 1
+				if idx%9 < 4 && idx/9 < 4 {
+					topLeft += 1
+				}
+			}
+		}
+	}
+	if moved == 0 {
+		t.Fatal("no mine was moved")
+	}
+	// the top left 4x4 is 16 of the 77 cells a mine could move to
+	if frac := float64(topLeft) / float64(moved); frac > 0.35 {
+		t.Errorf("%d of %d moved mines went to the top left", topLeft, moved)
+	}
+}
+
+func TestZeroOpening(t *testing.T) {
+	for seed := int64(0); seed < 50; seed++ {
+		g, err := New(9, 9, 30, seed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		g.ZeroOpening = true
+		if err := g.Probe(4, 4); err != nil {
+			t.Fatal(err)
+		}
+		if touching := g.touching(4, 4); touching != 0 {
+			t.Errorf("seed %d: first probe touches %d mines", seed, touching)
+		}
+		mines := 0
+		for _, mine := range g.mines {
+			if mine {
+				mines += 1
+			}
+		}
+		if mines != 30 {
+			t.Errorf("seed %d: %d mines after the first probe, expected 30", seed, mines)
+		}
+	}
+}
+
+func TestZeroOpeningCrowded(t *testing.T) {
+	// there is no room to clear the neighbors, but the probe is still safe
+	g, err := New(3, 3, 8, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.ZeroOpening = true
+	if err := g.Probe(1, 1); err != nil {
+		t.Fatal(err)
+	}
+	if !g.Living() || !g.Victory() {
+		t.Errorf("probing the only safe cell should win")
+	}
+}
@@ -0,0 +1,224 @@
+// Package fakeserver plays the server side of a DefuseDivision connection from
+// a script, so that clients can be tested without a real server.
+//
+// A script is a list of Steps, run in order against a single connection: send
+// these messages, expect the client to send this command, wait, disconnect.
+// Messages are framed with the protocol package, like a real server's, unless
+// a step deliberately breaks the framing to test how a client copes.
+//
+//	s := fakeserver.Start(
+//		fakeserver.Send(defusedivision.PlayerMsg{Player: p}),
+//		fakeserver.Expect("PROBE"),
+//		fakeserver.Split(3, defusedivision.NewStateMsg{State: st}),
+//	)
+//	defer s.Close()
+//	c := client.NewConn(s.Client)
+package fakeserver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"reflect"
+	"time"
+
+	"github.com/lelandbatey/minesweeper-solver/defusedivision"
+	"github.com/lelandbatey/minesweeper-solver/protocol"
+)
+
+// A Step is one thing the server does in a script. A step returning an error
+// ends the script.
+type Step func(c *Conn) error
+
+// A Conn is the server's end of a connection.
+type Conn struct {
+	net.Conn
+	// r buffers what the client sends, for both dec and ExpectRaw
+	r   *bufio.Reader
+	dec *protocol.Decoder
+}
+
+// A Server runs a script against the client end of an in-memory connection.
+type Server struct {
+	// Client is the end of the connection for the client under test.
+	Client net.Conn
+	server net.Conn
+	done   chan error
+}
+
+// Start runs script in the background, on a new connection.
+func Start(script ...Step) *Server {
+	client, server := net.Pipe()
+	s := &Server{Client: client, server: server, done: make(chan error, 1)}
+	go s.run(script)
+	return s
+}
+
+func (s *Server) run(script []Step) {
+	r := bufio.NewReader(s.server)
+	c := &Conn{Conn: s.server, r: r, dec: protocol.NewDecoder(r)}
+	for idx, step := range script {
+		if err := step(c); err != nil {
+			s.done <- fmt.Errorf("step %d: %v", idx+1, err)
+			return
+		}
+	}
+	s.done <- nil
+	// take whatever else the client sends, so it isn't left blocked
+	io.Copy(ioutil.Discard, s.server)
+}
+
+// Wait waits for the script to finish, and returns the error of the step
+// which failed, if any.
+func (s *Server) Wait() error {
+	err := <-s.done
+	s.done <- err
+	return err
+}
+
+// Close closes the server's end of the connection.
+func (s *Server) Close() error {
+	return s.server.Close()
+}
+
+// Send sends each of msgs.
+func Send(msgs ...defusedivision.Message) Step {
+	return Split(0, msgs...)
+}
+
+// Split sends each of msgs in writes of n bytes, so that the client has to
+// put frames, and delimiters, back together. An n of zero sends each message
+// in one write.
+func Split(n int, msgs ...defusedivision.Message) Step {
+	return func(c *Conn) error {
+		for _, msg := range msgs {
+			data, err := defusedivision.EncodeMessage(msg)
+			if err != nil {
+				return err
+			}
+			frame, err := Frame(data)
+			if err != nil {
+				return err
+			}
+			if err := c.write(frame, n); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Raw writes data as it is, which need not be a well framed message.
+func Raw(data []byte) Step {
+	return func(c *Conn) error {
+		return c.write(data, 0)
+	}
+}
+
+// Corrupt sends a frame whose gzipped contents are damaged.
+func Corrupt() Step {
+	return func(c *Conn) error {
+		frame, err := Frame([]byte(`"corrupt"`))
+		if err != nil {
+			return err
+		}
+		// the byte after the gzip header is the start of the compressed
+		// data
+		frame[10] ^= 0xff
+		return c.write(frame, 0)
+	}
+}
+
+// Expect reads the next message from the client, and fails unless it is
+// command, as JSON.
+func Expect(command interface{}) Step {
+	return func(c *Conn) error {
+		var got interface{}
+		if err := c.dec.Decode(&got); err != nil {
+			return fmt.Errorf("expecting %v: %v", command, err)
+		}
+		want, err := normalize(command)
+		if err != nil {
+			return err
+		}
+		if !reflect.DeepEqual(got, want) {
+			return fmt.Errorf("got %v, expected %v", got, want)
+		}
+		return nil
+	}
+}
+
+// ExpectRaw reads len(data) bytes from the client, and fails unless they are
+// data exactly.
+func ExpectRaw(data []byte) Step {
+	return func(c *Conn) error {
+		got := make([]byte, len(data))
+		n, err := io.ReadFull(c.r, got)
+		for idx := 0; idx < n; idx++ {
+			if got[idx] != data[idx] {
+				return fmt.Errorf("byte %d of %d is %#02x, expected %#02x", idx, len(data), got[idx], data[idx])
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("got %d of %d bytes: %v", n, len(data), err)
+		}
+		return nil
+	}
+}
+
+// Delay waits for d.
+func Delay(d time.Duration) Step {
+	return func(c *Conn) error {
+		time.Sleep(d)
+		return nil
+	}
+}
+
+// Disconnect closes the connection.
+func Disconnect() Step {
+	return func(c *Conn) error {
+		return c.Close()
+	}
+}
+
+// Frame returns data framed as a real server frames it.
+func Frame(data []byte) ([]byte, error) {
+	var frame bytes.Buffer
+	if err := protocol.NewEncoder(&frame).WriteMessage(data); err != nil {
+		return nil, err
+	}
+	return frame.Bytes(), nil
+}
+
+// write writes data in pieces of n bytes, or all at once if n is zero.
+func (c *Conn) write(data []byte, n int) error {
+	if n <= 0 {
+		n = len(data)
+	}
+	for len(data) > 0 {
+		piece := data
+		if len(piece) > n {
+			piece = piece[:n]
+		}
+		if _, err := c.Write(piece); err != nil {
+			return err
+		}
+		data = data[len(piece):]
+	}
+	return nil
+}
+
+// normalize returns v as it would be after a round trip through JSON.
+func normalize(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var rv interface{}
+	err = json.Unmarshal(data, &rv)
+	return rv, err
+}
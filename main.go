@@ -1,38 +1,131 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"net"
 	"os"
-	"reflect"
+	"strings"
 	"time"
 
 	//"github.com/davecgh/go-spew/spew"
 	"github.com/lelandbatey/minesweeper-solver/client"
-	"github.com/lelandbatey/minesweeper-solver/defusedivision"
+	"github.com/lelandbatey/minesweeper-solver/engine"
+	"github.com/lelandbatey/minesweeper-solver/fakeserver"
+	"github.com/lelandbatey/minesweeper-solver/recording"
+	"github.com/lelandbatey/minesweeper-solver/runner"
 	"github.com/lelandbatey/minesweeper-solver/solver"
-	"github.com/y0ssar1an/q"
+	"github.com/lelandbatey/minesweeper-solver/tui"
+	"github.com/lelandbatey/minesweeper-solver/wiretap"
+)
+
+var (
+	local  = flag.Bool("local", false, "play against an in-process board instead of a DefuseDivision server")
+	seed   = flag.Int64("seed", 0, "seed of the local board; 0 picks one from the clock")
+	width  = flag.Int("width", 16, "width of the local board")
+	height = flag.Int("height", 16, "height of the local board")
+	mines  = flag.Int("mines", 40, "number of mines on the local board")
+
+	strategy = flag.String("strategy", "exact", "strategy to play with: "+strings.Join(solver.StrategyNames(), ", "))
+	first    = flag.String("first", "safe", "what the ruleset promises about the first probe: any, safe or zero")
+	opening  = flag.String("opening", "auto", "where to probe first: auto, corner, edge or center")
+	timeout  = flag.Duration("timeout", client.DefaultTimeout, "longest to wait to connect, or for the server to answer a move")
+	record   = flag.String("record", "", "file to record the game to, which cmd/replay can replay")
+	showTUI  = flag.Bool("tui", false, "show the game on a full screen board, which can be paused and stepped through")
+	tape     = flag.String("tape", "", "file to record the bytes sent to and from the server to")
+	replay   = flag.String("replay", "", "tape to play back instead of connecting to a server; the game must be played with the same flags as it was recorded with")
 )
 
 func main() {
+	flag.Parse()
+	if _, ok := solver.Strategies[*strategy]; !ok {
+		fmt.Fprintf(os.Stderr, "unknown strategy %q, expected one of %v\n", *strategy, solver.StrategyNames())
+		os.Exit(2)
+	}
+	if _, err := solver.OpeningCell(1, 1, 0, solver.FirstClick(*first), solver.Opening(*opening)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if *local {
+		if *seed == 0 {
+			*seed = time.Now().UnixNano()
+		}
+		g, err := engine.New(*width, *height, *mines, *seed)
+		if err != nil {
+			panic(err)
+		}
+		g.ZeroOpening = solver.FirstClick(*first) == solver.FirstClickZero
+		// always log the seed, so a lost game can be replayed exactly
+		fmt.Printf("local game %dx%d with %d mines, seed %d\n", *width, *height, *mines, g.Seed())
+		play(context.Background(), runner.Local{Game: g}, recording.Header{Seed: g.Seed(), Field: g.Minefield(), State: g.State()})
+		fmt.Printf("seed %d\n", g.Seed())
+		return
+	}
 
-	// add default arguments to connect to local-server if none supplied
-	os.Args = append(os.Args, "127.0.0.1", "44444")
-	host := os.Args[1]
-	port := os.Args[2]
-	c, err := client.New(host, port)
-	go client.NetReader(c)
+	// default arguments connect to a local server if none are supplied
+	host := "127.0.0.1"
+	port := "44444"
+	if flag.NArg() >= 2 {
+		host = flag.Arg(0)
+		port = flag.Arg(1)
+	}
+	dial := func(ctx context.Context) (net.Conn, error) {
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+	}
+	if *replay != "" {
+		dial = replayTape(*replay)
+	}
+	if *tape != "" {
+		f, err := os.Create(*tape)
+		if err != nil {
+			panic(err)
+		}
+		defer f.Close()
+		t := wiretap.NewTape(f)
+		defer func() {
+			if err := t.Err(); err != nil {
+				fmt.Printf("recording the tape failed: %v\n", err)
+			}
+		}()
+		dial = t.Dial(dial)
+	}
+	ctx := context.Background()
+	dialCtx, cancel := context.WithTimeout(ctx, *timeout)
+	c, err := client.Dial(dialCtx, dial)
+	cancel()
 	if err != nil {
 		panic(err)
 	}
-	time.Sleep(400 * time.Millisecond)
-	fmt.Printf("We did it, we opened a client named %s!\n", c.Name)
-	q.Q("Now we wait for a message:")
+	defer c.Close()
+	c.Timeout = *timeout
+	if !*showTUI {
+		c.Log = os.Stdout
+	}
+	fmt.Println("We did it, we opened a client!")
 	// Get the first message, which is the player struct for ourself. This also
 	// causes our client to modify itself by changing it's name to the name of
 	// the player sent by the server.
-	c.Message()
-	// The second message will be the full state from the server.
-	fmt.Printf("%v\n", reflect.TypeOf(c.Message()))
+	waitCtx, cancel := context.WithTimeout(ctx, *timeout)
+	defer cancel()
+	if _, err := c.Player(waitCtx); err != nil {
+		fmt.Fprintf(os.Stderr, "no player message: %v\n", err)
+		c.Close()
+		os.Exit(1)
+	}
+	fmt.Printf("playing as %s\n", c.Name)
+	// the game starts from the first state, which follows the player
+	// message, so that a recording doesn't start from nothing
+	player, err := c.Resync(waitCtx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "no state message: %v\n", err)
+		c.Close()
+		os.Exit(1)
+	}
 	// now we try to send a config to resize the minefield
 	//	c.Send(`
 	//{
@@ -45,110 +138,90 @@ func main() {
 	//	`)
 	//	spew.Dump(c.Message())
 	//	time.Sleep(400 * time.Millisecond)
-	state := defusedivision.State{}
-	_ = state
-	player := defusedivision.Player{}
-	x := 0
-	y := 0
-	for {
-		// ProbeXY also updates the status of x,y, & living
-		state, player, _ = c.ProbeXY(x, y)
+	play(ctx, c, recording.Header{Field: player.Field, State: c.State()})
+}
 
-		if c.Living == false {
-			fmt.Printf("aw... Exploded @ (%v, %v)\n", x, y)
-			break
-		}
-		board := player.Field
-		sboard, err := solver.NewMinefield(board)
+// play plays one game, which starts as described by start, until the bot
+// either explodes or wins.
+func play(ctx context.Context, g runner.Game, start recording.Header) {
+	field := start.Field
+	open, err := solver.OpeningCell(field.Width, field.Height, field.Minecount, solver.FirstClick(*first), solver.Opening(*opening))
+	if err != nil {
+		panic(err)
+	}
+	var recs []runner.Recorder
+	if *record != "" {
+		f, err := os.Create(*record)
 		if err != nil {
 			panic(err)
 		}
-		// find the probability of cells containing a mine
-		solver.PrimedFieldProbability(sboard)
-		fmt.Println(sboard.Render())
-
-		// flag all cells that 100% contain a mine
-		for _, unflaggedCell := range solver.UnflaggedMines(sboard) {
-			x := unflaggedCell.X
-			y := unflaggedCell.Y
-			c.FlagXY(x, y)
-			fmt.Printf("f") //fmt.Printf("%v\n", reflect.TypeOf(c.Message()))
+		defer f.Close()
+		start.Strategy = *strategy
+		w, err := recording.NewWriter(f, start)
+		if err != nil {
+			panic(err)
 		}
-
-		// find lowest-probability cell to probe
-		safest := solver.GetSafestCell(sboard)
-		stillNotCertain := true
-		if safest.MineProb > 0.0 {
-			// if probability isn't 0, then we should try hypothetical scenarios
-			// to see if we can nail down a cell that cannot be a mine
-			// we do this by setting a mine probability to 1.0 and then
-			// running the probability calculations. Then we ask if any
-			// "impossible" scenario has happened: such as too many nearby
-			// mines...
-			// If so, then our hypothetical mine cannot be a mine, since it
-			// violates our knowledge of the board by putting too many mines
-			// nearby a revealed #
-			witnesses := solver.GetWitnesses(sboard)
-			primedCells := solver.GetPrimedCells(sboard)
-			// get non 1.0 or 0.0 probability for mines & get cells
-			// that don't immediately clash with witnesses if they are
-			// marked as a mine
-			primedCells = solver.GetValidPrimedCells(witnesses, primedCells)
-			// keep track of which cells were valid hypothetical mines
-			// once we have a success in satisfying all witnesses, add all
-			// hypothetically-flagged cells to this list and avoid using them
-			// again; it'll just find the same solution (or another) but
-			// definitely will NOT find a failure
-			// (basically, optimize to skip already known successes)
-			validHypotheticalMine := map[[2]int]bool{}
-			for _, cell := range primedCells {
-				validHypotheticalMine[[2]int{cell.X, cell.Y}] = false
-			}
-			likelyhood := map[uint]*solver.Cell{}
-			bestScenario := uint(0) // get min integer
-			fmt.Printf("size of primed cells: %v\n", len(primedCells))
-			fmt.Printf("size of witnesses: %v\n", len(witnesses))
-			for _, hypothetical := range primedCells {
-				coordinates := [2]int{hypothetical.X, hypothetical.Y}
-				// skip testing this cell if it's already been proven to be
-				// part of a successful hypothetically-flagged scenario
-				if validHypotheticalMine[coordinates] {
-					continue
-				}
-				// indicate "thinking". Useful when script takes a looong time
-				fmt.Printf(".")
-				tempProb := hypothetical.MineProb
-				// mark this cell as a mine
-				hypothetical.MineProb = 1.0
-				flags, scenarios, success, err := solver.SatisfyWitnesses(witnesses, primedCells)
-				_ = err
-				hypothetical.MineProb = tempProb
-				if !success {
-					fmt.Printf("found a hypothetical non-mine of ")
-					safest = hypothetical
-					stillNotCertain = false
-					break
-				} else {
-					for coordinates, _ := range flags {
-						validHypotheticalMine[coordinates] = true
-					}
-				}
-				likelyhood[scenarios] = hypothetical
-				if scenarios > bestScenario {
-					bestScenario = scenarios
-				}
-			}
-			if stillNotCertain {
-				fmt.Printf("well I'm still not certain, but the best scenario")
-				fmt.Printf(" had %v scenarios\n", bestScenario)
-				safest = likelyhood[bestScenario]
+		defer func() {
+			if err := w.Err(); err != nil {
+				fmt.Printf("recording failed: %v\n", err)
 			}
+		}()
+		recs = append(recs, w)
+	}
+	log := io.Writer(os.Stdout)
+	out := io.Writer(os.Stdout)
+	if *showTUI {
+		// what the game prints waits until the TUI has given the
+		// terminal back, which happens first
+		var after bytes.Buffer
+		defer func() { os.Stdout.Write(after.Bytes()) }()
+		out = &after
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+		// without a terminal stty can't change, keys just need enter
+		if restore, err := tui.Raw(os.Stdin); err == nil {
+			defer restore()
 		}
-		x = safest.X
-		y = safest.Y
-		fmt.Printf("%v @ (%v, %v)\n", safest.MineProb, x, y)
+		ui := tui.New(os.Stdout, os.Stdin, *strategy, cancel)
+		defer ui.Close()
+		recs = append(recs, ui)
+		log = nil
+	}
+	fmt.Fprintf(out, "opening @ (%v, %v)\n", open[0], open[1])
+	result, err := runner.PlayRecorded(ctx, g, solver.Strategies[*strategy], open, log, runner.MultiRecorder(recs...))
+	if err != nil {
+		fmt.Fprintf(out, "%v\n", err)
 	}
+	fmt.Fprintf(out, "%d probes, %d of them guesses\n", result.Moves, result.Guesses)
+	if result.Resyncs > 0 {
+		fmt.Fprintf(out, "resynced %d times after losing the connection\n", result.Resyncs)
+	}
+}
 
-	//	spew.Dump(state)
-	time.Sleep(10 * time.Second)
+// replayTape returns a dial function whose connections are played back from
+// the tape in path, one for each connection recorded.
+func replayTape(path string) func(ctx context.Context) (net.Conn, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+	scripts, err := wiretap.Scripts(f)
+	if err != nil {
+		panic(err)
+	}
+	return func(ctx context.Context) (net.Conn, error) {
+		if len(scripts) == 0 {
+			return nil, errors.New("no more connections on the tape")
+		}
+		s := fakeserver.Start(scripts[0]...)
+		scripts = scripts[1:]
+		go func() {
+			if err := s.Wait(); err != nil {
+				fmt.Printf("client went off the tape: %v\n", err)
+			}
+		}()
+		return s.Client, nil
+	}
 }
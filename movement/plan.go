@@ -0,0 +1,169 @@
+// Package movement plans the order in which a bot carries out its actions, so
+// that the cursor travels as little as possible between them.
+//
+// A DefuseDivision client can only act on the cell under its cursor, and
+// moves the cursor one cell at a time, so reaching a cell costs its Manhattan
+// distance from the cursor. Visiting a set of cells in the cheapest order is a
+// travelling salesman problem; Plan builds a route greedily from the nearest
+// cell and then improves it with 2-opt moves, which is close to optimal for
+// the handful of actions a strategy returns at a time.
+package movement
+
+import "github.com/lelandbatey/minesweeper-solver/solver"
+
+// maxImprovements bounds the 2-opt passes made by Plan.
+const maxImprovements = 50
+
+// Distance returns the number of cursor moves between two cells.
+func Distance(a, b [2]int) int {
+	return abs(a[0]-b[0]) + abs(a[1]-b[1])
+}
+
+// Travel returns the number of cursor moves needed to carry out actions in
+// order, starting with the cursor at start.
+func Travel(start [2]int, actions []solver.Action) int {
+	total := 0
+	at := start
+	for _, a := range actions {
+		total += Distance(at, a.Cell)
+		at = a.Cell
+	}
+	return total
+}
+
+// Plan reorders actions to reduce the cursor travel from start. A chord is
+// kept after any flags next to it, since it relies on them, and a probe or
+// chord of a cell after any action on that cell which came before it, such
+// as the flag taking a wrong flag off. A final guess stays last, since
+// nothing should be risked before the certain actions are done. Actions are
+// otherwise independent of each other.
+func Plan(start [2]int, actions []solver.Action) []solver.Action {
+	rest := actions
+	last := []solver.Action{}
+	if n := len(actions); n > 0 && actions[n-1].Guess() {
+		rest, last = actions[:n-1], actions[n-1:]
+	}
+	order := nearest(start, rest)
+	order = improve(start, rest, order)
+	route := make([]solver.Action, 0, len(actions))
+	for _, idx := range order {
+		route = append(route, rest[idx])
+	}
+	return append(route, last...)
+}
+
+// nearest builds a route, as indices of actions, by always moving to the
+// nearest action which can be carried out next, taking the earliest of
+// equally near actions.
+func nearest(start [2]int, actions []solver.Action) []int {
+	route := make([]int, 0, len(actions))
+	done := make([]bool, len(actions))
+	at := start
+	for len(route) < len(actions) {
+		best := -1
+		for idx, a := range actions {
+			if done[idx] || !ready(idx, actions, done) {
+				continue
+			}
+			if best == -1 || Distance(at, a.Cell) < Distance(at, actions[best].Cell) {
+				best = idx
+			}
+		}
+		done[best] = true
+		route = append(route, best)
+		at = actions[best].Cell
+	}
+	return route
+}
+
+// ready reports whether actions[a] can be carried out once the actions
+// marked done have been.
+func ready(a int, actions []solver.Action, done []bool) bool {
+	for b := range actions {
+		if !done[b] && b != a && follows(actions, a, b) {
+			return false
+		}
+	}
+	return true
+}
+
+// follows reports whether actions[a] has to be carried out after actions[b]:
+// a chord after the flags next to it, and a probe or chord of a cell after
+// any earlier action on the same cell.
+func follows(actions []solver.Action, a, b int) bool {
+	first, then := actions[b], actions[a]
+	if then.Kind == solver.ActionChord && first.Kind == solver.ActionFlag && adjacent(then.Cell, first.Cell) {
+		return true
+	}
+	return b < a && then.Cell == first.Cell && (then.Kind == solver.ActionProbe || then.Kind == solver.ActionChord)
+}
+
+// improve applies 2-opt moves to route, reversing any stretch of it whose
+// reversal shortens the route without putting an action before one it
+// follows, until no reversal helps.
+func improve(start [2]int, actions []solver.Action, route []int) []int {
+	route = append([]int{}, route...)
+	cell := func(i int) [2]int {
+		return actions[route[i]].Cell
+	}
+	for pass := 0; pass < maxImprovements; pass++ {
+		improved := false
+		for i := 0; i < len(route)-1; i++ {
+			before := start
+			if i > 0 {
+				before = cell(i - 1)
+			}
+			for j := i + 1; j < len(route); j++ {
+				// only the moves into and out of the reversed stretch
+				// change
+				change := Distance(before, cell(j)) - Distance(before, cell(i))
+				if j+1 < len(route) {
+					after := cell(j + 1)
+					change += Distance(cell(i), after) - Distance(cell(j), after)
+				}
+				if change >= 0 {
+					continue
+				}
+				reverse(route[i : j+1])
+				if valid(actions, route) {
+					improved = true
+				} else {
+					reverse(route[i : j+1])
+				}
+			}
+		}
+		if !improved {
+			break
+		}
+	}
+	return route
+}
+
+// valid reports whether no action of route comes before one it follows.
+func valid(actions []solver.Action, route []int) bool {
+	for i, a := range route {
+		for _, b := range route[i+1:] {
+			if follows(actions, a, b) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func reverse(route []int) {
+	for i, j := 0, len(route)-1; i < j; i, j = i+1, j-1 {
+		route[i], route[j] = route[j], route[i]
+	}
+}
+
+func adjacent(a, b [2]int) bool {
+	return a != b && abs(a[0]-b[0]) <= 1 && abs(a[1]-b[1]) <= 1
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
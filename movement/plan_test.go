@@ -0,0 +1,100 @@
+package movement
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+
+	"github.com/lelandbatey/minesweeper-solver/solver"
+)
+
+func probe(x, y int) solver.Action {
+	return solver.Action{Kind: solver.ActionProbe, Cell: [2]int{x, y}}
+}
+
+func TestPlanShortensRoute(t *testing.T) {
+	// zig-zagging across the board, when the cells lie along two rows
+	actions := []solver.Action{probe(9, 0), probe(0, 1), probe(8, 0), probe(1, 1), probe(7, 0), probe(2, 1)}
+	planned := Plan([2]int{0, 0}, actions)
+	if len(planned) != len(actions) {
+		t.Fatalf("planned %d actions, expected %d", len(planned), len(actions))
+	}
+	before, after := Travel([2]int{0, 0}, actions), Travel([2]int{0, 0}, planned)
+	if after >= before {
+		t.Errorf("planned travel %d, expected less than %d", after, before)
+	}
+	// the best route goes along one row and back along the other
+	if after != 11 {
+		t.Errorf("planned travel %d, expected 11: %v", after, planned)
+	}
+}
+
+func TestPlanKeepsGuessLast(t *testing.T) {
+	guess := probe(0, 0)
+	guess.Probability = 0.2
+	actions := []solver.Action{probe(5, 5), probe(1, 1), guess}
+	planned := Plan([2]int{0, 0}, actions)
+	if last := planned[len(planned)-1]; last.Cell != guess.Cell || !last.Guess() {
+		t.Errorf("guess moved from the end: %v", planned)
+	}
+}
+
+// checkOrder checks that planned is a valid order of actions, whose Rules
+// are their indices.
+func checkOrder(t *testing.T, actions, planned []solver.Action) {
+	t.Helper()
+	if len(planned) != len(actions) {
+		t.Fatalf("planned %d actions, expected %d", len(planned), len(actions))
+	}
+	route := []int{}
+	for _, a := range planned {
+		idx, err := strconv.Atoi(string(a.Rule))
+		if err != nil {
+			t.Fatal(err)
+		}
+		route = append(route, idx)
+	}
+	if !valid(actions, route) {
+		t.Fatalf("an action comes before one it follows in %v", planned)
+	}
+}
+
+func TestPlanFlagsBeforeChords(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for trial := 0; trial < 100; trial++ {
+		actions := []solver.Action{}
+		for i := 0; i < 12; i++ {
+			kind := []solver.ActionKind{solver.ActionFlag, solver.ActionChord, solver.ActionProbe}[rng.Intn(3)]
+			action := solver.Action{Kind: kind, Cell: [2]int{rng.Intn(6), rng.Intn(6)}}
+			action.Rule = solver.Rule(strconv.Itoa(i))
+			actions = append(actions, action)
+		}
+		checkOrder(t, actions, Plan([2]int{rng.Intn(6), rng.Intn(6)}, actions))
+	}
+}
+
+func TestPlanUnflagsBeforeProbing(t *testing.T) {
+	// the flag takes a wrong flag off (8, 1), which can only be probed
+	// after; on its own, 2-opt reverses the stretch ending with the pair
+	actions := []solver.Action{
+		{Kind: solver.ActionFlag, Cell: [2]int{8, 1}},
+		probe(8, 1),
+		probe(2, 2),
+		probe(0, 8),
+		probe(7, 3),
+		probe(2, 4),
+	}
+	for idx := range actions {
+		actions[idx].Rule = solver.Rule(strconv.Itoa(idx))
+	}
+	planned := Plan([2]int{2, 6}, actions)
+	checkOrder(t, actions, planned)
+	for _, a := range planned {
+		if a.Cell == [2]int{8, 1} {
+			if a.Kind != solver.ActionFlag {
+				t.Errorf("probed (8, 1) before taking its flag off: %v", planned)
+			}
+			break
+		}
+	}
+}
@@ -0,0 +1,183 @@
+// Package protocol reads and writes the framing of DefuseDivision messages.
+//
+// Each message is a JSON value, gzipped, followed by Delimiter. The delimiter
+// isn't escaped, so a message whose gzipped form happens to contain it can't
+// be framed as it is; the gzip trailer alone holds it for any message of 256
+// bytes. JSON allows trailing whitespace, so the Encoder pads such a message
+// until its gzipped form no longer contains the delimiter.
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// Delimiter ends every message on the wire.
+var Delimiter = []byte{'\x00', '\x01', '\x00'}
+
+// DefaultMaxSize is the MaxSize of a new Encoder or Decoder.
+const DefaultMaxSize = 1 << 20
+
+// maxPadding bounds the whitespace added to a message to frame it.
+const maxPadding = 64
+
+// ErrTooLarge is reported for a message longer than MaxSize.
+var ErrTooLarge = errors.New("protocol: message too large")
+
+// A MessageError reports a single message which couldn't be read. The Decoder
+// skips past it, so the next message can still be read.
+type MessageError struct {
+	Err error
+}
+
+func (e *MessageError) Error() string {
+	return fmt.Sprintf("protocol: bad message: %v", e.Err)
+}
+
+func (e *MessageError) Unwrap() error {
+	return e.Err
+}
+
+// An Encoder writes messages to a stream.
+type Encoder struct {
+	w io.Writer
+	// MaxSize is the longest message, as JSON, which will be written.
+	MaxSize int
+}
+
+// NewEncoder returns an Encoder writing to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w, MaxSize: DefaultMaxSize}
+}
+
+// Encode writes v, encoded as JSON, as one message.
+func (e *Encoder) Encode(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return e.WriteMessage(data)
+}
+
+// WriteMessage writes data, which must be JSON, as one message. The frame is
+// written with a single Write, so Encoders on one stream don't interleave.
+func (e *Encoder) WriteMessage(data []byte) error {
+	frame, err := encode(data, e.MaxSize)
+	if err != nil {
+		return err
+	}
+	_, err = e.w.Write(frame)
+	return err
+}
+
+// encode returns data, which must be JSON, gzipped and delimited as a single
+// message of at most maxSize bytes before compression.
+func encode(data []byte, maxSize int) ([]byte, error) {
+	if len(data) > maxSize {
+		return nil, ErrTooLarge
+	}
+	padded := append([]byte{}, data...)
+	for pad := 0; pad <= maxPadding; pad++ {
+		var frame bytes.Buffer
+		w := gzip.NewWriter(&frame)
+		if _, err := w.Write(padded); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		if !bytes.Contains(frame.Bytes(), Delimiter) {
+			frame.Write(Delimiter)
+			return frame.Bytes(), nil
+		}
+		padded = append(padded, ' ')
+	}
+	return nil, errors.New("protocol: message can't be framed")
+}
+
+// A Decoder reads messages from a stream.
+type Decoder struct {
+	r *bufio.Reader
+	// MaxSize is the longest message, both gzipped and as JSON, which will
+	// be read. Longer messages are skipped with ErrTooLarge.
+	MaxSize int
+}
+
+// NewDecoder returns a Decoder reading from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: bufio.NewReader(r), MaxSize: DefaultMaxSize}
+}
+
+// ReadMessage returns the JSON of the next message. A message which can't be
+// read is reported as a *MessageError, and skipped; any other error comes
+// from the stream. The stream ending between messages is io.EOF, and
+// ending within one is io.ErrUnexpectedEOF.
+func (d *Decoder) ReadMessage() ([]byte, error) {
+	frame := []byte{}
+	tooLarge := false
+	for !bytes.HasSuffix(frame, Delimiter) {
+		// the delimiter starts with a zero byte, so reading up to each
+		// zero byte can't miss one, however the stream is split
+		chunk, err := d.r.ReadSlice(Delimiter[0])
+		frame = append(frame, chunk...)
+		if len(frame) > d.MaxSize+len(Delimiter) {
+			// skip the rest of the message, keeping enough of it to
+			// recognise its end
+			tooLarge = true
+			frame = append(frame[:0], frame[len(frame)-len(Delimiter):]...)
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err == io.EOF && len(frame) > 0 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if tooLarge {
+		return nil, &MessageError{ErrTooLarge}
+	}
+	data, err := gunzip(frame[:len(frame)-len(Delimiter)], d.MaxSize)
+	if err != nil {
+		return nil, &MessageError{err}
+	}
+	return data, nil
+}
+
+// Decode reads the next message and stores its JSON in v.
+func (d *Decoder) Decode(v interface{}) error {
+	data, err := d.ReadMessage()
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return &MessageError{err}
+	}
+	return nil
+}
+
+// gunzip returns data decompressed, unless that is longer than maxSize.
+func gunzip(data []byte, maxSize int) ([]byte, error) {
+	gzr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer gzr.Close()
+	// read one byte too many to tell whether the message is too long
+	out, err := ioutil.ReadAll(io.LimitReader(gzr, int64(maxSize)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(out) > maxSize {
+		return nil, ErrTooLarge
+	}
+	return out, nil
+}
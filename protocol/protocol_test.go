@@ -0,0 +1,159 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"unicode/utf8"
+)
+
+func TestRoundTrip(t *testing.T) {
+	msgs := []string{`"UP"`, `["update-selected", ["p", [1, 2]]]`, `{"name": "p"}`, `[]`}
+	var stream bytes.Buffer
+	enc := NewEncoder(&stream)
+	for _, msg := range msgs {
+		if err := enc.WriteMessage([]byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// one byte at a time splits every delimiter across reads
+	dec := NewDecoder(iotest.OneByteReader(&stream))
+	for _, want := range msgs {
+		got, err := dec.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(bytes.TrimRight(got, " ")) != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+	if _, err := dec.ReadMessage(); err != io.EOF {
+		t.Errorf("after the last message got %v, want EOF", err)
+	}
+}
+
+func TestEncodeAvoidsDelimiter(t *testing.T) {
+	// the gzip trailer of a 256 byte message ends with its length, 00 01 00 00
+	msg := `"` + strings.Repeat("a", 254) + `"`
+	var stream bytes.Buffer
+	if err := NewEncoder(&stream).WriteMessage([]byte(msg)); err != nil {
+		t.Fatal(err)
+	}
+	frame := stream.Bytes()
+	if idx := bytes.Index(frame, Delimiter); idx != len(frame)-len(Delimiter) {
+		t.Fatalf("delimiter at %d of a %d byte frame", idx, len(frame))
+	}
+	var got string
+	if err := NewDecoder(&stream).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got != msg[1:len(msg)-1] {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestDecoderSkipsBadMessages(t *testing.T) {
+	var stream bytes.Buffer
+	enc := NewEncoder(&stream)
+	enc.WriteMessage([]byte(`"` + strings.Repeat("x", 100) + `"`))
+	stream.WriteString("not gzip")
+	stream.Write(Delimiter)
+	enc.WriteMessage([]byte(`"FLAG"`))
+
+	dec := NewDecoder(&stream)
+	dec.MaxSize = 50
+	for _, want := range []error{ErrTooLarge, nil} {
+		_, err := dec.ReadMessage()
+		var bad *MessageError
+		if !errors.As(err, &bad) {
+			t.Fatalf("got %v, want a MessageError", err)
+		}
+		if want != nil && !errors.Is(err, want) {
+			t.Errorf("got %v, want %v", err, want)
+		}
+	}
+	got, err := dec.ReadMessage()
+	if err != nil || string(got) != `"FLAG"` {
+		t.Errorf("got %q, %v after the bad messages", got, err)
+	}
+}
+
+func TestDecoderUnexpectedEOF(t *testing.T) {
+	var stream bytes.Buffer
+	NewEncoder(&stream).WriteMessage([]byte(`"PROBE"`))
+	truncated := stream.Bytes()[:stream.Len()-2]
+	if _, err := NewDecoder(bytes.NewReader(truncated)).ReadMessage(); err != io.ErrUnexpectedEOF {
+		t.Errorf("got %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
+
+func TestEncoderMaxSize(t *testing.T) {
+	enc := NewEncoder(io.Discard)
+	enc.MaxSize = 4
+	if err := enc.WriteMessage([]byte(`"LEFT"`)); err != ErrTooLarge {
+		t.Errorf("got %v, want %v", err, ErrTooLarge)
+	}
+}
+
+func FuzzDecoder(f *testing.F) {
+	var stream bytes.Buffer
+	NewEncoder(&stream).WriteMessage([]byte(`["new-state", {"players": {}}]`))
+	f.Add(stream.Bytes())
+	f.Add([]byte("\x00\x01\x00\x00\x01"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		dec := NewDecoder(bytes.NewReader(data))
+		dec.MaxSize = 64
+		for {
+			msg, err := dec.ReadMessage()
+			var bad *MessageError
+			if errors.As(err, &bad) {
+				continue
+			}
+			if err != nil {
+				return
+			}
+			if len(msg) > dec.MaxSize {
+				t.Fatalf("read a %d byte message", len(msg))
+			}
+		}
+	})
+}
+
+func FuzzRoundTrip(f *testing.F) {
+	f.Add("\"UP\"", uint8(1))
+	f.Add(`"`+strings.Repeat("a", 254)+`"`, uint8(7))
+	f.Fuzz(func(t *testing.T, msg string, chunk uint8) {
+		if !utf8.ValidString(msg) {
+			// JSON replaces invalid UTF-8, which isn't the framing's doing
+			t.Skip()
+		}
+		var stream bytes.Buffer
+		if err := NewEncoder(&stream).Encode(msg); err != nil {
+			t.Skip(err)
+		}
+		dec := NewDecoder(&chunkReader{r: &stream, n: int(chunk)%16 + 1})
+		var got string
+		if err := dec.Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got != msg {
+			t.Fatalf("got %q, want %q", got, msg)
+		}
+	})
+}
+
+// chunkReader reads at most n bytes at a time from r.
+type chunkReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	if len(p) > c.n {
+		p = p[:c.n]
+	}
+	return c.r.Read(p)
+}
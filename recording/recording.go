@@ -0,0 +1,278 @@
+// Package recording saves the games played by runner.PlayRecorded, and reads
+// them back so they can be replayed.
+//
+// A recording is a file of JSON values, one per line, written as the game is
+// played so that a game which crashes still leaves a recording behind. The
+// first line is {"header": Header}, holding the board and state before the
+// first probe. Each line after that is one of
+//
+//	{"decision": Decision}  the strategy decided on some actions
+//	{"move": Move}          an action was taken, and the game answered
+//	{"resync": Resync}      the game was resynced after an action failed
+package recording
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/lelandbatey/minesweeper-solver/defusedivision"
+	"github.com/lelandbatey/minesweeper-solver/runner"
+	"github.com/lelandbatey/minesweeper-solver/solver"
+)
+
+// Version is the version of the format written by Writer.
+const Version = 1
+
+// A Header describes the game before its first probe.
+type Header struct {
+	Version  int    `json:"version"`
+	Strategy string `json:"strategy"`
+	// Seed is the seed of a local board, or 0 for a game against a server.
+	Seed    int64     `json:"seed,omitempty"`
+	Started time.Time `json:"started"`
+	// Field is the player's board, and State the state of the game.
+	Field defusedivision.Minefield `json:"field"`
+	State defusedivision.State     `json:"state"`
+}
+
+// A Decision is one call to a strategy.
+type Decision struct {
+	Time time.Time `json:"time"`
+	// Probs holds the MineProb of each cell, by row, as the strategy left
+	// them. Cells the strategy had no probability for are -1.
+	Probs   [][]float64     `json:"probs"`
+	Actions []solver.Action `json:"actions"`
+}
+
+// A Move is one action taken in the game, and the game's answer to it.
+type Move struct {
+	Action   solver.Action `json:"action"`
+	Sent     time.Time     `json:"sent"`
+	Answered time.Time     `json:"answered"`
+	// Player is the player the game answered with. It is nil for flags,
+	// and for actions which failed.
+	Player *defusedivision.Player `json:"player,omitempty"`
+	// Others are the other players of the state the game answered with.
+	Others map[string]defusedivision.Player `json:"others,omitempty"`
+	Err    string                           `json:"error,omitempty"`
+
+	// Board is the board the move was made on. It isn't saved, but filled
+	// in by Read.
+	Board defusedivision.Minefield `json:"-"`
+}
+
+// A Resync is the player a game resynced to.
+type Resync struct {
+	Time   time.Time             `json:"time"`
+	Player defusedivision.Player `json:"player"`
+}
+
+// entry is a single line of a recording, with exactly one field set.
+type entry struct {
+	Header   *Header   `json:"header,omitempty"`
+	Decision *Decision `json:"decision,omitempty"`
+	Move     *Move     `json:"move,omitempty"`
+	Resync   *Resync   `json:"resync,omitempty"`
+}
+
+// A Writer records a game to an io.Writer. It is a runner.Recorder.
+type Writer struct {
+	enc *json.Encoder
+	err error
+}
+
+// NewWriter writes header, and returns a Writer recording the rest of the
+// game after it.
+func NewWriter(w io.Writer, header Header) (*Writer, error) {
+	header.Version = Version
+	if header.Started.IsZero() {
+		header.Started = time.Now()
+	}
+	rw := &Writer{enc: json.NewEncoder(w)}
+	if err := rw.enc.Encode(entry{Header: &header}); err != nil {
+		return nil, err
+	}
+	return rw, nil
+}
+
+// Err returns the first error writing the recording, if any. A Writer stops
+// writing after an error, but the game goes on.
+func (w *Writer) Err() error {
+	return w.err
+}
+
+func (w *Writer) write(e entry) {
+	if w.err == nil {
+		w.err = w.enc.Encode(e)
+	}
+}
+
+func (w *Writer) Decided(mf *solver.Minefield, actions []solver.Action) {
+	probs := make([][]float64, mf.Height)
+	for _, c := range mf.Cells {
+		if probs[c.Y] == nil {
+			probs[c.Y] = make([]float64, mf.Width)
+		}
+		probs[c.Y][c.X] = c.MineProb
+	}
+	w.write(entry{Decision: &Decision{Time: time.Now(), Probs: probs, Actions: actions}})
+}
+
+func (w *Writer) Moved(move runner.Move) {
+	m := Move{Action: move.Action, Sent: move.Sent, Answered: move.Answered}
+	if move.Err != nil {
+		m.Err = move.Err.Error()
+	} else if move.Action.Kind != solver.ActionFlag {
+		player := move.Player
+		m.Player = &player
+		// the player's own entry of the state would only repeat Player
+		for name, other := range move.State.Players {
+			if name == player.Name {
+				continue
+			}
+			if m.Others == nil {
+				m.Others = map[string]defusedivision.Player{}
+			}
+			m.Others[name] = other
+		}
+	}
+	w.write(entry{Move: &m})
+}
+
+func (w *Writer) Resynced(player defusedivision.Player) {
+	w.write(entry{Resync: &Resync{Time: time.Now(), Player: player}})
+}
+
+// A Recording is a game read back by Read, split into rounds.
+type Recording struct {
+	Header Header
+	Rounds []Round
+	// Board is the board as it was at the end of the recording.
+	Board defusedivision.Minefield
+}
+
+// A Round is one decision of the strategy, and the moves made on it. The
+// first round is the first probe, which has no decision.
+type Round struct {
+	// Board is the board the round was decided on.
+	Board    defusedivision.Minefield
+	Decision *Decision
+	Moves    []Move
+	// Resync is set if the round ended with the game resyncing.
+	Resync *Resync
+}
+
+// Read reads a recording written by a Writer.
+func Read(r io.Reader) (*Recording, error) {
+	dec := json.NewDecoder(r)
+	var first entry
+	if err := dec.Decode(&first); err != nil {
+		return nil, fmt.Errorf("reading header: %v", err)
+	}
+	if first.Header == nil {
+		return nil, errors.New("recording doesn't start with a header")
+	}
+	if first.Header.Version != Version {
+		return nil, fmt.Errorf("unsupported recording version %d", first.Header.Version)
+	}
+	rec := &Recording{Header: *first.Header, Board: first.Header.Field}
+	round := &Round{Board: rec.Board}
+	for line := 2; ; line++ {
+		var e entry
+		err := dec.Decode(&e)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return rec, fmt.Errorf("line %d: %v", line, err)
+		}
+		switch {
+		case e.Decision != nil:
+			rec.Rounds = append(rec.Rounds, *round)
+			round = &Round{Board: rec.Board, Decision: e.Decision}
+		case e.Move != nil:
+			e.Move.Board = rec.Board
+			round.Moves = append(round.Moves, *e.Move)
+			rec.Board = after(rec.Board, *e.Move)
+		case e.Resync != nil:
+			round.Resync = e.Resync
+			rec.Board = e.Resync.Player.Field
+		default:
+			return rec, fmt.Errorf("line %d: unknown entry", line)
+		}
+	}
+	rec.Rounds = append(rec.Rounds, *round)
+	return rec, nil
+}
+
+// after returns the board after move was made on board.
+func after(board defusedivision.Minefield, move Move) defusedivision.Minefield {
+	if move.Player != nil {
+		return move.Player.Field
+	}
+	if move.Err != "" || move.Action.Kind != solver.ActionFlag {
+		return board
+	}
+	// flags are answered with nothing, so the flag is put on the board
+	// here
+	return board.ToggleFlag(move.Action.Cell[0], move.Action.Cell[1])
+}
+
+// Minefield returns board as the solver sees it, with the MineProb of each
+// unprobed cell taken from probs, so that it renders with the probabilities a
+// decision was made with. Without probs, unprobed cells render as unknown.
+func Minefield(board defusedivision.Minefield, probs [][]float64) (*solver.Minefield, error) {
+	mf, err := solver.NewMinefield(board)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range mf.Cells {
+		switch {
+		case c.Probed:
+			c.MineProb = 0.0
+		case c.Y < len(probs) && c.X < len(probs[c.Y]):
+			c.MineProb = probs[c.Y][c.X]
+		}
+	}
+	return mf, nil
+}
+
+// Diverge asks strategy to decide on the board the round was decided on, and
+// returns the actions which only the recorded decision took and those which
+// only strategy takes. Actions are compared by their kind and cell alone.
+func (r Round) Diverge(strategy solver.Strategy) (recorded, rerun []solver.Action, err error) {
+	if r.Decision == nil {
+		return nil, nil, nil
+	}
+	mf, err := solver.NewMinefield(r.Board)
+	if err != nil {
+		return nil, nil, err
+	}
+	actions, err := strategy.NextActions(mf)
+	if err != nil {
+		return nil, nil, err
+	}
+	return missing(r.Decision.Actions, actions), missing(actions, r.Decision.Actions), nil
+}
+
+// missing returns the actions of a which aren't in b.
+func missing(a, b []solver.Action) []solver.Action {
+	type key struct {
+		kind solver.ActionKind
+		cell [2]int
+	}
+	in := map[key]bool{}
+	for _, action := range b {
+		in[key{action.Kind, action.Cell}] = true
+	}
+	var rv []solver.Action
+	for _, action := range a {
+		if !in[key{action.Kind, action.Cell}] {
+			rv = append(rv, action)
+		}
+	}
+	return rv
+}
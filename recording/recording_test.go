@@ -0,0 +1,149 @@
+package recording
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/lelandbatey/minesweeper-solver/engine"
+	"github.com/lelandbatey/minesweeper-solver/runner"
+	"github.com/lelandbatey/minesweeper-solver/solver"
+)
+
+// record plays a local game with strategy and returns its recording.
+func record(t *testing.T, seed int64, strategy solver.Strategy) (*engine.Game, runner.Result, *bytes.Buffer) {
+	t.Helper()
+	g, err := engine.New(9, 9, 10, seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, Header{Strategy: strategy.Name(), Seed: seed, Field: g.Minefield(), State: g.State()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := runner.PlayRecorded(context.Background(), runner.Local{Game: g}, strategy, [2]int{0, 0}, nil, w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return g, result, &buf
+}
+
+func TestRecordLocalGame(t *testing.T) {
+	for seed := int64(1); seed <= 10; seed++ {
+		g, result, buf := record(t, seed, solver.ExactStrategy{})
+		rec, err := Read(buf)
+		if err != nil {
+			t.Fatalf("seed %d: %v", seed, err)
+		}
+		if rec.Header.Seed != seed || rec.Header.Strategy != "exact" {
+			t.Errorf("seed %d: read header %+v", seed, rec.Header)
+		}
+		moves := 0
+		for _, round := range rec.Rounds {
+			for _, move := range round.Moves {
+				if move.Action.Kind != solver.ActionFlag {
+					moves += 1
+				}
+			}
+		}
+		if moves != result.Moves {
+			t.Errorf("seed %d: recorded %d probes and chords, played %d", seed, moves, result.Moves)
+		}
+		// the board at the end, flags included, is the game's
+		want := g.Minefield()
+		for idx, cell := range rec.Board.Cells {
+			if cell.Probed != want.Cells[idx].Probed || cell.Flagged != want.Cells[idx].Flagged {
+				t.Errorf("seed %d: recorded board differs at (%d, %d)", seed, cell.X, cell.Y)
+				break
+			}
+		}
+		// the strategy which played the game agrees with itself
+		for idx, round := range rec.Rounds {
+			recorded, rerun, err := round.Diverge(solver.ExactStrategy{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(recorded) != 0 || len(rerun) != 0 {
+				t.Errorf("seed %d round %d: diverged, recorded %v, rerun %v", seed, idx, recorded, rerun)
+			}
+		}
+	}
+}
+
+func TestDiverge(t *testing.T) {
+	_, _, buf := record(t, 3, solver.ExactStrategy{})
+	rec, err := Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.Rounds) < 2 {
+		t.Fatal("game ended on its first probe")
+	}
+	recorded, rerun, err := rec.Rounds[1].Diverge(flagger{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recorded) != len(rec.Rounds[1].Decision.Actions) {
+		t.Errorf("got %d actions only recorded, want all %d", len(recorded), len(rec.Rounds[1].Decision.Actions))
+	}
+	if len(rerun) != 1 || rerun[0].Cell != [2]int{8, 8} {
+		t.Errorf("got %v only rerun", rerun)
+	}
+}
+
+// flagger is a strategy which only ever flags (8, 8).
+type flagger struct{}
+
+func (flagger) Name() string {
+	return "flagger"
+}
+
+func (flagger) NextActions(mf *solver.Minefield) ([]solver.Action, error) {
+	return []solver.Action{{Kind: solver.ActionFlag, Cell: [2]int{8, 8}}}, nil
+}
+
+func TestMinefieldRendersProbabilities(t *testing.T) {
+	for seed := int64(1); seed <= 20; seed++ {
+		_, _, buf := record(t, seed, solver.ExactStrategy{})
+		rec, err := Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, round := range rec.Rounds {
+			if round.Decision == nil {
+				continue
+			}
+			actions := round.Decision.Actions
+			guess := actions[len(actions)-1]
+			if !guess.Guess() {
+				continue
+			}
+			// a guess is made after the strategy works out every
+			// probability
+			mf, err := Minefield(round.Board, round.Decision.Probs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cell := mf.Cells[guess.Cell[0]+guess.Cell[1]*mf.Width]
+			if cell.MineProb != guess.Probability {
+				t.Errorf("seed %d: guess at %v rendered with probability %v, want %v", seed, guess.Cell, cell.MineProb, guess.Probability)
+			}
+			return
+		}
+	}
+	t.Fatal("no game needed a guess")
+}
+
+func TestReadRejectsOtherVersions(t *testing.T) {
+	if _, err := Read(strings.NewReader(`{"header": {"version": 99}}`)); err == nil {
+		t.Errorf("read a recording of an unknown version")
+	}
+	if _, err := Read(strings.NewReader(`{"move": {}}`)); err == nil {
+		t.Errorf("read a recording without a header")
+	}
+}
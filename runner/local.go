@@ -0,0 +1,38 @@
+package runner
+
+import (
+	"context"
+
+	"github.com/lelandbatey/minesweeper-solver/defusedivision"
+	"github.com/lelandbatey/minesweeper-solver/engine"
+)
+
+// Local lets a strategy play an engine.Game the same way it plays against a
+// DefuseDivision server. Actions never wait, so ctx is only checked before
+// each one.
+type Local struct {
+	*engine.Game
+}
+
+func (l Local) ProbeXY(ctx context.Context, X int, Y int) (defusedivision.State, defusedivision.Player, error) {
+	if err := ctx.Err(); err != nil {
+		return l.State(), l.Player(), err
+	}
+	err := l.Probe(X, Y)
+	return l.State(), l.Player(), err
+}
+
+func (l Local) FlagXY(ctx context.Context, X int, Y int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return l.Flag(X, Y)
+}
+
+func (l Local) ChordXY(ctx context.Context, X int, Y int) (defusedivision.State, defusedivision.Player, error) {
+	if err := ctx.Err(); err != nil {
+		return l.State(), l.Player(), err
+	}
+	err := l.Chord(X, Y)
+	return l.State(), l.Player(), err
+}
@@ -0,0 +1,339 @@
+// Package runner plays whole games of minesweeper with a solver strategy,
+// against either a DefuseDivision server or a local engine, and measures how
+// the strategy did.
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/lelandbatey/minesweeper-solver/defusedivision"
+	"github.com/lelandbatey/minesweeper-solver/movement"
+	"github.com/lelandbatey/minesweeper-solver/solver"
+)
+
+// A Game is anything a strategy can play against. client.Client plays against
+// a DefuseDivision server; Local wraps an engine.Game. Each action gives up
+// with the error of its context once the context is done.
+type Game interface {
+	ProbeXY(ctx context.Context, X int, Y int) (defusedivision.State, defusedivision.Player, error)
+	FlagXY(ctx context.Context, X int, Y int) error
+	ChordXY(ctx context.Context, X int, Y int) (defusedivision.State, defusedivision.Player, error)
+}
+
+// A Resyncer is a Game which can lose touch with the game it plays, such as
+// client.Client when its connection drops, and catch up again.
+type Resyncer interface {
+	// Resync waits until the game can be played again, and returns the
+	// player as the game now has it.
+	Resync(ctx context.Context) (defusedivision.Player, error)
+}
+
+// A Recorder is told about each step of a game played by PlayRecorded, so that
+// the game can be saved and replayed later, or shown as it's played. The game
+// waits for each call to return, so a Recorder can also pace the game.
+type Recorder interface {
+	// Decided is called with the board the strategy was asked about, its
+	// cells' MineProb as the strategy left them, and the actions decided on
+	// in the order they are about to be taken.
+	Decided(mf *solver.Minefield, actions []solver.Action)
+	// Moved is called after each action, including the first probe.
+	Moved(move Move)
+	// Resynced is called with the player a game resynced to.
+	Resynced(player defusedivision.Player)
+}
+
+// An Intervener is a Recorder through which someone watching the game can
+// take actions of their own, such as a person at a terminal. After Decided
+// and after each Moved, the game asks for any actions to take in place of
+// the rest of those decided, then has the strategy decide again.
+type Intervener interface {
+	Intervention() []solver.Action
+}
+
+// A Move is one action taken in a game, and the game's answer to it.
+type Move struct {
+	Action solver.Action
+	// Sent is when the action was started, and Answered when it finished.
+	Sent     time.Time
+	Answered time.Time
+	// State and Player are the game's answer. Both are empty for flags,
+	// which are answered with nothing but an error.
+	State  defusedivision.State
+	Player defusedivision.Player
+	Err    error
+}
+
+// maxResyncs bounds the resyncs in a single game, so that a game which keeps
+// failing isn't resynced forever.
+const maxResyncs = 10
+
+// A Result describes how a single game went.
+type Result struct {
+	Won bool
+	// Moves is the number of probes and chords made, including the first
+	// probe.
+	Moves int
+	// Guesses is the number of probes made without knowing the cell was
+	// safe, not counting the first probe.
+	Guesses int
+	// Travel is the number of cursor moves between the cells acted on.
+	Travel int
+	// Thinking is the total time spent by the strategy deciding moves.
+	Thinking time.Duration
+	// Progress is the fraction of safe cells which had been probed when
+	// the game ended.
+	Progress float64
+	// Resyncs is the number of times the game was resynced after an action
+	// failed.
+	Resyncs int
+}
+
+// Play plays a game from its first probe at first until it is won or lost,
+// asking strategy for the actions to take after that. The board and every
+// action are written to log as the game goes, unless log is nil. Play stops
+// with an error once ctx is done.
+//
+// If an action fails and g is a Resyncer, the game continues from the board
+// g resyncs to, instead of ending with the error.
+func Play(ctx context.Context, g Game, strategy solver.Strategy, first [2]int, log io.Writer) (Result, error) {
+	return PlayRecorded(ctx, g, strategy, first, log, nil)
+}
+
+// PlayRecorded plays a game like Play, telling rec about every decision and
+// action along the way, unless rec is nil. If rec is an Intervener, the
+// actions it asks for are taken too.
+func PlayRecorded(ctx context.Context, g Game, strategy solver.Strategy, first [2]int, log io.Writer, rec Recorder) (Result, error) {
+	verbose := log != nil
+	if !verbose {
+		log = ioutil.Discard
+	}
+	if rec == nil {
+		rec = nopRecorder{}
+	}
+	result := Result{}
+	move := Move{Action: solver.Action{Kind: solver.ActionProbe, Cell: first}, Sent: time.Now()}
+	move.State, move.Player, move.Err = g.ProbeXY(ctx, first[0], first[1])
+	move.Answered = time.Now()
+	rec.Moved(move)
+	player, err := move.Player, move.Err
+	if err != nil {
+		err = fmt.Errorf("probe @ (%v, %v) failed: %v", first[0], first[1], err)
+		if player, err = resync(ctx, g, &result, err, log); err != nil {
+			return result, err
+		}
+		rec.Resynced(player)
+	}
+	result.Moves += 1
+	intervener, _ := rec.(Intervener)
+	// every round of actions probes at least one new cell, so there can't be
+	// more rounds than cells
+	for round := 0; ; round++ {
+		result.Progress = progress(player.Field)
+		if over(player, log) {
+			result.Won = player.Living
+			return result, nil
+		}
+		if round > len(player.Field.Cells) {
+			return result, errors.New("strategy made more moves than there are cells")
+		}
+
+		mf, err := solver.NewMinefield(player.Field)
+		if err != nil {
+			return result, err
+		}
+		start := time.Now()
+		actions, err := strategy.NextActions(mf)
+		result.Thinking += time.Since(start)
+		if err != nil {
+			return result, err
+		}
+		if verbose {
+			fmt.Fprintln(log, mf.Render())
+		}
+		cursor := selected(player.Field)
+		actions = movement.Plan(cursor, actions)
+		rec.Decided(mf, actions)
+		intervened := false
+		if extra := intervention(intervener); len(extra) > 0 {
+			actions, intervened = extra, true
+		}
+		for idx := 0; idx < len(actions); idx++ {
+			action := actions[idx]
+			x, y := action.Cell[0], action.Cell[1]
+			if action.Kind == solver.ActionProbe && probed(player.Field, action.Cell) {
+				// earlier actions may have opened the cell already
+				continue
+			}
+			result.Travel += movement.Distance(cursor, action.Cell)
+			cursor = action.Cell
+			move := Move{Action: action, Sent: time.Now()}
+			switch action.Kind {
+			case solver.ActionFlag:
+				move.Err = g.FlagXY(ctx, x, y)
+			case solver.ActionProbe:
+				move.State, move.Player, move.Err = g.ProbeXY(ctx, x, y)
+				result.Moves += 1
+				if action.Guess() {
+					result.Guesses += 1
+				}
+			case solver.ActionChord:
+				move.State, move.Player, move.Err = g.ChordXY(ctx, x, y)
+				result.Moves += 1
+			default:
+				move.Err = fmt.Errorf("unsupported action %q", action.Kind)
+			}
+			move.Answered = time.Now()
+			rec.Moved(move)
+			if action.Kind != solver.ActionFlag {
+				player = move.Player
+			} else if move.Err == nil {
+				// a flag is answered with nothing, so it's put on the
+				// board here; otherwise a round ending in a flag would
+				// leave the next round to flag the cell again, which
+				// takes the flag off
+				player.Field = player.Field.ToggleFlag(x, y)
+			}
+			if err = move.Err; err != nil {
+				err = fmt.Errorf("%s @ (%v, %v) failed: %v", action.Kind, x, y, err)
+				if player, err = resync(ctx, g, &result, err, log); err != nil {
+					return result, err
+				}
+				rec.Resynced(player)
+				// the rest of the actions were decided on the old board
+				break
+			}
+			fmt.Fprintf(log, "%v\n", action)
+			if !player.Living || player.Field.Victory {
+				break
+			}
+			if extra := intervention(intervener); len(extra) > 0 {
+				actions, intervened = append(actions[:idx+1:idx+1], extra...), true
+			}
+		}
+		if intervened {
+			// a round cut short by an intervention needn't have
+			// probed anything
+			round -= 1
+		}
+	}
+}
+
+// intervention returns the actions i wants taken, if i isn't nil.
+func intervention(i Intervener) []solver.Action {
+	if i == nil {
+		return nil
+	}
+	return i.Intervention()
+}
+
+// resync resyncs g after an action failed with cause, and returns the player
+// to continue from. It returns cause if g can't be resynced.
+func resync(ctx context.Context, g Game, result *Result, cause error, log io.Writer) (defusedivision.Player, error) {
+	r, ok := g.(Resyncer)
+	if !ok || result.Resyncs >= maxResyncs {
+		return defusedivision.Player{}, cause
+	}
+	result.Resyncs += 1
+	fmt.Fprintf(log, "resyncing after: %v\n", cause)
+	player, err := r.Resync(ctx)
+	if err != nil {
+		return player, fmt.Errorf("%v, then resyncing failed: %v", cause, err)
+	}
+	return player, nil
+}
+
+// MultiRecorder returns a Recorder which tells each of recs about every step,
+// in turn.
+func MultiRecorder(recs ...Recorder) Recorder {
+	return multiRecorder(recs)
+}
+
+type multiRecorder []Recorder
+
+func (m multiRecorder) Decided(mf *solver.Minefield, actions []solver.Action) {
+	for _, rec := range m {
+		rec.Decided(mf, actions)
+	}
+}
+
+func (m multiRecorder) Moved(move Move) {
+	for _, rec := range m {
+		rec.Moved(move)
+	}
+}
+
+func (m multiRecorder) Resynced(player defusedivision.Player) {
+	for _, rec := range m {
+		rec.Resynced(player)
+	}
+}
+
+func (m multiRecorder) Intervention() []solver.Action {
+	actions := []solver.Action{}
+	for _, rec := range m {
+		if i, ok := rec.(Intervener); ok {
+			actions = append(actions, i.Intervention()...)
+		}
+	}
+	return actions
+}
+
+// nopRecorder is the Recorder of a game which isn't being recorded.
+type nopRecorder struct{}
+
+func (nopRecorder) Decided(mf *solver.Minefield, actions []solver.Action) {}
+func (nopRecorder) Moved(move Move)                                       {}
+func (nopRecorder) Resynced(player defusedivision.Player)                 {}
+
+// selected returns the cell under the cursor of mf.
+func selected(mf defusedivision.Minefield) [2]int {
+	if len(mf.Selected) < 2 {
+		return [2]int{}
+	}
+	return [2]int{mf.Selected[0], mf.Selected[1]}
+}
+
+// probed reports whether the cell at xy of mf has been probed.
+func probed(mf defusedivision.Minefield, xy [2]int) bool {
+	for _, cell := range mf.Cells {
+		if cell.X == xy[0] && cell.Y == xy[1] {
+			return cell.Probed
+		}
+	}
+	return false
+}
+
+// over reports whether the game has ended, and logs how.
+func over(player defusedivision.Player, log io.Writer) bool {
+	selected := player.Field.Selected
+	if !player.Living {
+		fmt.Fprintf(log, "aw... Exploded @ %v\n", selected)
+		return true
+	}
+	if player.Field.Victory {
+		fmt.Fprintf(log, "victory! last probe @ %v\n", selected)
+		return true
+	}
+	return false
+}
+
+// progress returns the fraction of the safe cells of mf which are probed.
+func progress(mf defusedivision.Minefield) float64 {
+	safe := len(mf.Cells) - mf.Minecount
+	if safe <= 0 {
+		return 1.0
+	}
+	probed := 0
+	for _, cell := range mf.Cells {
+		// a probed mine is the one which ended the game
+		if cell.Probed && !(cell.Contents == " b ") {
+			probed += 1
+		}
+	}
+	return float64(probed) / float64(safe)
+}
@@ -0,0 +1,152 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/lelandbatey/minesweeper-solver/defusedivision"
+	"github.com/lelandbatey/minesweeper-solver/engine"
+	"github.com/lelandbatey/minesweeper-solver/solver"
+)
+
+func TestPlayFinishesEveryGame(t *testing.T) {
+	for _, name := range solver.StrategyNames() {
+		for seed := int64(1); seed <= 20; seed++ {
+			g, err := engine.New(9, 9, 10, seed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := Play(context.Background(), Local{Game: g}, solver.Strategies[name], [2]int{0, 0}, nil)
+			if err != nil {
+				t.Fatalf("%s seed %d: %v", name, seed, err)
+			}
+			if !g.Over() {
+				t.Errorf("%s seed %d: game not over", name, seed)
+			}
+			if result.Won != g.Victory() {
+				t.Errorf("%s seed %d: result won=%v, game victory=%v", name, seed, result.Won, g.Victory())
+			}
+			if result.Won && result.Progress != 1.0 {
+				t.Errorf("%s seed %d: won with progress %v", name, seed, result.Progress)
+			}
+			if result.Guesses >= result.Moves {
+				t.Errorf("%s seed %d: %d guesses in %d moves", name, seed, result.Guesses, result.Moves)
+			}
+		}
+	}
+}
+
+func TestPlayStopsRepeatedMoves(t *testing.T) {
+	g, err := engine.New(9, 9, 10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Play(context.Background(), Local{Game: g}, stuck{}, [2]int{0, 0}, nil); err == nil {
+		t.Errorf("expected an error from a strategy which makes no progress")
+	}
+}
+
+// stuck is a strategy which only ever flags the same cell.
+type stuck struct{}
+
+func (stuck) Name() string {
+	return "stuck"
+}
+
+func (stuck) NextActions(mf *solver.Minefield) ([]solver.Action, error) {
+	return []solver.Action{{Kind: solver.ActionFlag, Cell: [2]int{8, 8}}}, nil
+}
+
+func TestPlayResyncs(t *testing.T) {
+	g, err := engine.New(9, 9, 10, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &flaky{Local: Local{Game: g}, failAt: 2}
+	result, err := Play(context.Background(), f, solver.Strategies["exact"], [2]int{0, 0}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Resyncs != 1 {
+		t.Errorf("resynced %d times, want 1", result.Resyncs)
+	}
+	if result.Won != g.Victory() {
+		t.Errorf("result won %v, but the game says %v", result.Won, g.Victory())
+	}
+}
+
+// flaky is a game whose probe number failAt fails without being played, like
+// a probe lost with its connection.
+type flaky struct {
+	Local
+	probes int
+	failAt int
+}
+
+func (f *flaky) ProbeXY(ctx context.Context, X int, Y int) (defusedivision.State, defusedivision.Player, error) {
+	f.probes += 1
+	if f.probes == f.failAt {
+		return defusedivision.State{}, defusedivision.Player{}, errors.New("connection reset")
+	}
+	return f.Local.ProbeXY(ctx, X, Y)
+}
+
+func (f *flaky) Resync(ctx context.Context) (defusedivision.Player, error) {
+	return f.Player(), nil
+}
+
+func TestPlayIntervenes(t *testing.T) {
+	g, err := engine.New(9, 9, 10, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := &intervener{}
+	if _, err := PlayRecorded(context.Background(), Local{Game: g}, solver.Strategies["exact"], [2]int{0, 0}, nil, MultiRecorder(i)); err != nil {
+		t.Fatal(err)
+	}
+	if !g.Over() {
+		t.Errorf("game not over")
+	}
+	// the flag is taken in place of everything first decided, and the
+	// strategy decides again straight after
+	want := []string{"decided", "flag", "decided"}
+	if len(i.steps) < 3 || i.steps[1] != want[1] || i.steps[2] != want[2] {
+		t.Errorf("steps began %v, want %v", i.steps, want)
+	}
+}
+
+// intervener flags the first unprobed cell once the strategy has first
+// decided, and notes each step of the game after the first probe.
+type intervener struct {
+	steps []string
+	flag  *solver.Action
+}
+
+func (i *intervener) Decided(mf *solver.Minefield, actions []solver.Action) {
+	i.steps = append(i.steps, "decided")
+	if i.flag != nil {
+		return
+	}
+	for _, c := range mf.Cells {
+		if !c.Probed && !c.Flagged {
+			i.flag = &solver.Action{Kind: solver.ActionFlag, Cell: [2]int{c.X, c.Y}}
+			return
+		}
+	}
+}
+
+func (i *intervener) Moved(move Move) {
+	if len(i.steps) > 0 {
+		i.steps = append(i.steps, string(move.Action.Kind))
+	}
+}
+
+func (i *intervener) Resynced(player defusedivision.Player) {}
+
+func (i *intervener) Intervention() []solver.Action {
+	if i.flag == nil || len(i.steps) != 1 {
+		return nil
+	}
+	return []solver.Action{*i.flag}
+}
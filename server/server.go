@@ -0,0 +1,278 @@
+// Package server hosts games of minesweeper over the DefuseDivision protocol,
+// so that a bot can be played against a server without the original Python
+// implementation installed.
+//
+// Like the client package, the server frames messages with the protocol
+// package, as gzipped JSON followed by "\x00\x01\x00". A connection is sent
+// its player first, then ["new-state", State] whenever any player's board
+// changes and ["update-selected", [name, [x, y]]] whenever any player moves
+// their cursor. Clients send the commands "UP", "DOWN", "LEFT", "RIGHT",
+// "PROBE" and "FLAG", each a JSON string; anything else is ignored.
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/lelandbatey/minesweeper-solver/defusedivision"
+	"github.com/lelandbatey/minesweeper-solver/engine"
+	"github.com/lelandbatey/minesweeper-solver/protocol"
+)
+
+// writeTimeout is the longest a connection may take to accept a message
+// before it is dropped.
+const writeTimeout = 5 * time.Second
+
+// queueLength is the number of messages which may wait to be written to a
+// connection before it is dropped for falling behind.
+const queueLength = 64
+
+// moves are the cursor movement commands, by the offset they move by.
+var moves = map[string][2]int{
+	"UP":    {0, -1},
+	"DOWN":  {0, 1},
+	"LEFT":  {-1, 0},
+	"RIGHT": {1, 0},
+}
+
+// A Config describes the board every player of a Server is given.
+type Config struct {
+	Width  int
+	Height int
+	Mines  int
+	// Seed lays out the mines, so every player plays the same board.
+	Seed int64
+	// ZeroOpening makes each player's first probe touch no mines.
+	ZeroOpening bool
+	// Log receives a line for each player joining or leaving and each
+	// command which fails, unless it is nil.
+	Log io.Writer
+}
+
+// A Server hosts one game for each connection, all on the same board.
+type Server struct {
+	config Config
+
+	mu      sync.Mutex
+	players map[string]*player
+	joined  int
+}
+
+// A player is one connection and the game it plays. Messages to the player
+// are queued on out, so that a slow connection can't stall the others, and
+// written in order by write.
+type player struct {
+	name string
+	conn net.Conn
+	enc  *protocol.Encoder
+	game *engine.Game
+	out  chan []byte
+	// dropped is set once the connection is closed for falling behind
+	dropped bool
+}
+
+// New returns a Server giving every player a board described by config.
+func New(config Config) (*Server, error) {
+	if _, err := engine.New(config.Width, config.Height, config.Mines, config.Seed); err != nil {
+		return nil, err
+	}
+	if config.Log == nil {
+		config.Log = ioutil.Discard
+	}
+	return &Server{config: config, players: map[string]*player{}}, nil
+}
+
+// Serve accepts connections on l and plays with each of them until ctx is
+// done, then closes l and every connection. It returns nil once ctx is done,
+// or the error from l if accepting fails first.
+func (s *Server) Serve(ctx context.Context, l net.Listener) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var handlers sync.WaitGroup
+	defer handlers.Wait()
+	go func() {
+		<-ctx.Done()
+		l.Close()
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for _, p := range s.players {
+			p.conn.Close()
+		}
+	}()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		handlers.Add(1)
+		go func() {
+			defer handlers.Done()
+			s.handle(ctx, conn)
+		}()
+	}
+}
+
+// handle plays with a single connection until it closes.
+func (s *Server) handle(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+	p, err := s.join(conn)
+	if err != nil {
+		fmt.Fprintf(s.config.Log, "%v: %v\n", conn.RemoteAddr(), err)
+		return
+	}
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		p.write(s.config.Log)
+	}()
+	defer func() {
+		s.leave(p)
+		<-written
+	}()
+	if ctx.Err() != nil {
+		return
+	}
+	dec := protocol.NewDecoder(conn)
+	for {
+		var command string
+		err = dec.Decode(&command)
+		var bad *protocol.MessageError
+		if errors.As(err, &bad) {
+			fmt.Fprintf(s.config.Log, "%s: ignoring message: %v\n", p.name, err)
+			continue
+		}
+		if err != nil {
+			break
+		}
+		s.command(p, command)
+	}
+	if err != nil && err != io.EOF && ctx.Err() == nil {
+		fmt.Fprintf(s.config.Log, "%s: %v\n", p.name, err)
+	}
+}
+
+// join creates the game for a new connection, tells the connection which
+// player it is, and tells everyone about the new player.
+func (s *Server) join(conn net.Conn) (*player, error) {
+	c := s.config
+	game, err := engine.New(c.Width, c.Height, c.Mines, c.Seed)
+	if err != nil {
+		return nil, err
+	}
+	game.ZeroOpening = c.ZeroOpening
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.joined += 1
+	game.Name = fmt.Sprintf("player%d", s.joined)
+	p := &player{name: game.Name, conn: conn, enc: protocol.NewEncoder(conn), game: game, out: make(chan []byte, queueLength)}
+	data, err := defusedivision.EncodeMessage(defusedivision.PlayerMsg{Player: game.Player()})
+	if err != nil {
+		return nil, err
+	}
+	p.out <- data
+	s.players[p.name] = p
+	fmt.Fprintf(c.Log, "%s joined from %v\n", p.name, conn.RemoteAddr())
+	s.broadcast(defusedivision.NewStateMsg{State: s.state()})
+	return p, nil
+}
+
+// leave removes p from the game, and tells everyone left.
+func (s *Server) leave(p *player) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.players, p.name)
+	close(p.out)
+	fmt.Fprintf(s.config.Log, "%s left\n", p.name)
+	s.broadcast(defusedivision.NewStateMsg{State: s.state()})
+}
+
+// command carries out a command sent by p, and tells everyone the outcome.
+func (s *Server) command(p *player, command string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	at := p.game.Selected()
+	if delta, ok := moves[command]; ok {
+		// moving off the board leaves the cursor where it is, which is
+		// still confirmed
+		p.game.Select(at[0]+delta[0], at[1]+delta[1])
+		s.broadcast(defusedivision.UpdateSelectedMsg{Name: p.name, Selected: p.game.Selected()})
+		return
+	}
+	var err error
+	switch command {
+	case "PROBE":
+		err = p.game.Probe(at[0], at[1])
+	case "FLAG":
+		err = p.game.Flag(at[0], at[1])
+	default:
+		fmt.Fprintf(s.config.Log, "%s: unknown command %q\n", p.name, command)
+		return
+	}
+	if err != nil {
+		// the state is sent regardless, so the player learns the game
+		// is over
+		fmt.Fprintf(s.config.Log, "%s: %s @ %v: %v\n", p.name, command, at, err)
+	}
+	s.broadcast(defusedivision.NewStateMsg{State: s.state()})
+}
+
+// state returns the state of every player's game. s.mu must be held.
+func (s *Server) state() defusedivision.State {
+	state := defusedivision.State{Ready: true, Players: map[string]defusedivision.Player{}}
+	for name, p := range s.players {
+		state.Players[name] = p.game.Player()
+	}
+	return state
+}
+
+// broadcast queues msg for every player, closing the connection of any
+// player whose queue is full. s.mu must be held.
+func (s *Server) broadcast(msg defusedivision.Message) {
+	data, err := defusedivision.EncodeMessage(msg)
+	if err != nil {
+		fmt.Fprintf(s.config.Log, "%s: %v\n", msg.Kind(), err)
+		return
+	}
+	for _, p := range s.players {
+		if p.dropped {
+			continue
+		}
+		select {
+		case p.out <- data:
+		default:
+			fmt.Fprintf(s.config.Log, "%s: too far behind, dropping\n", p.name)
+			p.dropped = true
+			p.conn.Close()
+		}
+	}
+}
+
+// write writes the messages queued for p until the queue is closed. Once one
+// can't be written, p's connection is closed and the rest are dropped.
+func (p *player) write(log io.Writer) {
+	failed := false
+	for data := range p.out {
+		if failed {
+			continue
+		}
+		err := p.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		if err == nil {
+			err = p.enc.WriteMessage(data)
+		}
+		if err != nil {
+			fmt.Fprintf(log, "%s: %v\n", p.name, err)
+			p.conn.Close()
+			failed = true
+		}
+	}
+}
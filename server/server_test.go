@@ -0,0 +1,158 @@
+package server
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lelandbatey/minesweeper-solver/client"
+	"github.com/lelandbatey/minesweeper-solver/defusedivision"
+	"github.com/lelandbatey/minesweeper-solver/runner"
+	"github.com/lelandbatey/minesweeper-solver/solver"
+)
+
+// serve starts a server for config on a free local port, and returns its
+// address. The server is stopped when the test ends.
+func serve(t *testing.T, config Config) (string, string) {
+	t.Helper()
+	s, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- s.Serve(ctx, l) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("serve: %v", err)
+		}
+	})
+	host, port, err := net.SplitHostPort(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return host, port
+}
+
+// connect returns a client of the server at host and port which knows its
+// player.
+func connect(t *testing.T, ctx context.Context, host, port string) (*client.Client, defusedivision.Player) {
+	t.Helper()
+	c, err := client.New(ctx, host, port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	player, err := c.Player(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, player
+}
+
+func TestPlayAgainstServer(t *testing.T) {
+	host, port := serve(t, Config{Width: 5, Height: 5, Mines: 3, Seed: 7, ZeroOpening: true})
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	c, player := connect(t, ctx, host, port)
+	if player.Field.Width != 5 || player.Field.Height != 5 || player.Field.Minecount != 3 {
+		t.Fatalf("player has a %dx%d board with %d mines", player.Field.Width, player.Field.Height, player.Field.Minecount)
+	}
+
+	result, err := runner.Play(ctx, c, solver.Strategies["exact"], [2]int{2, 2}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	final := c.State().Players[c.Name]
+	if result.Won != final.Field.Victory || result.Won != final.Living {
+		t.Errorf("result won %v, but the server says living %v with victory %v", result.Won, final.Living, final.Field.Victory)
+	}
+}
+
+func TestBroadcastsOtherPlayers(t *testing.T) {
+	host, port := serve(t, Config{Width: 4, Height: 4, Mines: 2, Seed: 1})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	watcher, _ := connect(t, ctx, host, port)
+	moves := make(chan defusedivision.UpdateSelectedMsg, 10)
+	watcher.Handle(defusedivision.KindUpdateSelected, func(msg defusedivision.Message) {
+		// handlers mustn't block the client, so extra moves are dropped
+		select {
+		case moves <- msg.(defusedivision.UpdateSelectedMsg):
+		default:
+		}
+	})
+	probed := make(chan string, 10)
+	watcher.Handle(defusedivision.KindNewState, func(msg defusedivision.Message) {
+		for name, p := range msg.(defusedivision.NewStateMsg).Players {
+			for _, cell := range p.Field.Cells {
+				if cell.X == 1 && cell.Y == 2 && cell.Probed {
+					select {
+					case probed <- name:
+					default:
+					}
+				}
+			}
+		}
+	})
+
+	mover, _ := connect(t, ctx, host, port)
+	if err := mover.MoveToXY(ctx, 1, 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := mover.ProbeXY(ctx, 1, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	var last defusedivision.UpdateSelectedMsg
+	for i := 0; i < 3; i++ {
+		select {
+		case last = <-moves:
+		case <-ctx.Done():
+			t.Fatalf("saw %d of 3 moves", i)
+		}
+	}
+	want := defusedivision.UpdateSelectedMsg{Name: mover.Name, Selected: [2]int{1, 2}}
+	if last != want {
+		t.Errorf("last move was %+v, want %+v", last, want)
+	}
+	select {
+	case name := <-probed:
+		if name != mover.Name {
+			t.Errorf("%s probed (1, 2), want %s", name, mover.Name)
+		}
+	case <-ctx.Done():
+		t.Errorf("watcher didn't see the probe at (1, 2)")
+	}
+}
+
+func TestStuckPlayerDoesntStallOthers(t *testing.T) {
+	s, err := New(Config{Width: 5, Height: 5, Mines: 3, Seed: 7, ZeroOpening: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), writeTimeout/2)
+	defer cancel()
+	// writes to a pipe block until the other end reads, which this one
+	// never does
+	stuck, stuckServer := net.Pipe()
+	defer stuck.Close()
+	go s.handle(ctx, stuckServer)
+
+	conn, connServer := net.Pipe()
+	go s.handle(ctx, connServer)
+	c := client.NewConn(conn)
+	defer c.Close()
+	if _, err := c.Player(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runner.Play(ctx, c, solver.Strategies["exact"], [2]int{2, 2}, nil); err != nil {
+		t.Fatalf("playing next to a stuck player: %v", err)
+	}
+}
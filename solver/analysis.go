@@ -0,0 +1,219 @@
+package solver
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// An Analysis holds everything the exact solver learned about a Minefield.
+// Cells are referred to by their (X, Y) coordinates, so an Analysis stays
+// valid no matter what later happens to the Cells it was made from.
+type Analysis struct {
+	// Probabilities maps each unprobed cell to the probability that it
+	// contains a mine. Unconstrained cells only have a probability when the
+	// Minecount of the minefield is known.
+	Probabilities map[[2]int]float64
+	// Safe and Mines are the cells which certainly don't or certainly do
+	// contain a mine, sorted by (Y, X).
+	Safe  [][2]int
+	Mines [][2]int
+	// Justifications explains each of Probabilities with the witnesses and
+	// configuration counts it was calculated from.
+	Justifications map[[2]int]Justification
+	// Contradictions lists the groups of witnesses which cannot all be
+	// satisfied. Cells constrained by those witnesses have no probability.
+	Contradictions []Contradiction
+	// Configurations is the number of complete boards which agree with the
+	// witnesses and the Minecount. It is nil unless the Minecount is known
+	// and there are no Contradictions, and nil if any Component was too
+	// large to enumerate and had its probabilities estimated instead.
+	Configurations *big.Int
+}
+
+// A Contradiction is a set of witnesses which no mine configuration can
+// satisfy at once, usually because the board was read or flagged wrongly.
+type Contradiction struct {
+	// Witnesses are the coordinates of the witnesses involved. It is empty
+	// when the contradiction is with the Minecount of the board.
+	Witnesses [][2]int
+	Reason    string
+}
+
+func (c Contradiction) Error() string {
+	return fmt.Sprintf("%s (witnesses %v)", c.Reason, c.Witnesses)
+}
+
+// Analyze calculates the exact mine probability of every unprobed cell of the
+// minefield, as described for ExactFieldProbability, without modifying the
+// minefield or any of its Cells. It is safe to call Analyze concurrently on
+// the same Minefield. A Component of the frontier too large to enumerate
+// quickly only gets estimated probabilities, justified by RuleHeuristic.
+//
+// A board whose witnesses contradict each other is not an error; the
+// offending witnesses are listed in the returned Analysis instead. An error
+// is only returned if mf is not a well formed Minefield.
+func Analyze(mf *Minefield) (Analysis, error) {
+	analysis := Analysis{
+		Probabilities:  map[[2]int]float64{},
+		Justifications: map[[2]int]Justification{},
+		Safe:           [][2]int{},
+		Mines:          [][2]int{},
+		Contradictions: []Contradiction{},
+	}
+	if mf == nil {
+		return analysis, errors.New("cannot analyze a nil minefield")
+	}
+	if len(mf.Cells) != mf.Width*mf.Height {
+		return analysis, fmt.Errorf("minefield of %dx%d has %d cells", mf.Width, mf.Height, len(mf.Cells))
+	}
+
+	components := SplitComponents(frontierWitnesses(mf), frontierCells(mf))
+	dists := make([]mineDistribution, len(components))
+	// estimates holds the estimated probabilities of the components too
+	// large to enumerate
+	estimates := make([][]float64, len(components))
+	for ci, component := range components {
+		var totals []uint64
+		var mines [][]uint64
+		ok := false
+		if len(component.Cells) <= maxComponentCells {
+			totals, mines, ok = enumerateFrontier(component.Witnesses, component.Cells)
+		}
+		if !ok {
+			estimates[ci] = estimateComponent(component)
+			dists[ci] = estimatedDistribution(estimates[ci])
+			continue
+		}
+		dists[ci] = mineDistribution{totals: totals, mines: mines}
+		if dists[ci].empty() {
+			analysis.Contradictions = append(analysis.Contradictions, Contradiction{
+				Witnesses: cellCoords(component.Witnesses),
+				Reason:    "no mine configuration satisfies the witnesses",
+			})
+		}
+	}
+
+	// record sets the probability of a cell from the weight of the
+	// configurations in which it holds a mine
+	record := func(cell *Cell, rule Rule, witnesses []*Cell, mines, total *big.Int) {
+		xy := [2]int{cell.X, cell.Y}
+		prob := ratio(mines, total)
+		analysis.Probabilities[xy] = prob
+		analysis.Justifications[xy] = Justification{
+			Rule:               rule,
+			Witnesses:          cellCoords(witnesses),
+			Configurations:     total,
+			MineConfigurations: mines,
+			Probability:        prob,
+		}
+	}
+
+	// estimate records the estimated probability of a cell of a component
+	// which wasn't enumerated
+	estimate := func(cell *Cell, witnesses []*Cell, prob float64) {
+		xy := [2]int{cell.X, cell.Y}
+		analysis.Probabilities[xy] = prob
+		analysis.Justifications[xy] = Justification{
+			Rule:        RuleHeuristic,
+			Witnesses:   cellCoords(witnesses),
+			Probability: prob,
+		}
+	}
+	for ci, component := range components {
+		for idx, cell := range component.Cells {
+			if estimates[ci] != nil {
+				estimate(cell, component.Witnesses, estimates[ci][idx])
+			}
+		}
+	}
+
+	weighted := false
+	if mf.Minecount > 0 && len(analysis.Contradictions) == 0 {
+		interior := GetUnconstrainedCells(mf)
+		weights, interiorWeight, total, err := weighDistributions(dists, len(interior), mf.Minecount)
+		if err != nil {
+			analysis.Contradictions = append(analysis.Contradictions, Contradiction{
+				Witnesses: [][2]int{},
+				Reason:    err.Error(),
+			})
+		} else {
+			weighted = true
+			analysis.Configurations = total
+			for ci, component := range components {
+				if estimates[ci] != nil {
+					// an estimate has no exact count of boards
+					analysis.Configurations = nil
+					continue
+				}
+				for idx, cell := range component.Cells {
+					record(cell, RuleEnumeration, component.Witnesses, weights[ci][idx], total)
+				}
+			}
+			for _, cell := range interior {
+				record(cell, RuleMineCount, nil, interiorWeight, total)
+			}
+		}
+	}
+	if !weighted {
+		// without a (usable) mine count, components are independent, so
+		// each one's probabilities only depend on its own configurations
+		for ci, component := range components {
+			if dists[ci].empty() || estimates[ci] != nil {
+				continue
+			}
+			for idx, cell := range component.Cells {
+				mines, total := dists[ci].cellCounts(idx)
+				record(cell, RuleEnumeration, component.Witnesses, mines, total)
+			}
+		}
+	}
+
+	for _, cell := range mf.Cells {
+		xy := [2]int{cell.X, cell.Y}
+		prob, ok := analysis.Probabilities[xy]
+		if !ok {
+			continue
+		}
+		if prob == 0.0 {
+			analysis.Safe = append(analysis.Safe, xy)
+		} else if prob == 1.0 {
+			analysis.Mines = append(analysis.Mines, xy)
+		}
+	}
+	return analysis, nil
+}
+
+// Apply sets the MineProb of every cell of mf which the Analysis has a
+// probability for, and sets the MineProb of probed cells to 0.0.
+func (a Analysis) Apply(mf *Minefield) {
+	for _, cell := range mf.Cells {
+		if cell.Probed {
+			cell.MineProb = 0.0
+		}
+		if prob, ok := a.Probabilities[[2]int{cell.X, cell.Y}]; ok {
+			cell.MineProb = prob
+		}
+	}
+}
+
+// Deductions returns the Safe and Mines cells of the Analysis as Deductions,
+// safe cells first, each with the Justification of its probability.
+func (a Analysis) Deductions() []Deduction {
+	deductions := []Deduction{}
+	for _, xy := range a.Safe {
+		deductions = append(deductions, Deduction{Cell: xy, Mine: false, Justification: a.Justifications[xy]})
+	}
+	for _, xy := range a.Mines {
+		deductions = append(deductions, Deduction{Cell: xy, Mine: true, Justification: a.Justifications[xy]})
+	}
+	return deductions
+}
+
+func cellCoords(cells []*Cell) [][2]int {
+	coords := make([][2]int, len(cells))
+	for idx, cell := range cells {
+		coords[idx] = [2]int{cell.X, cell.Y}
+	}
+	return coords
+}
@@ -0,0 +1,91 @@
+package solver
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestAnalyzeDoesNotModify(t *testing.T) {
+	mf := parseField(t,
+		"????",
+		".12?",
+	)
+	analysis, err := Analyze(mf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cell := range mf.Cells {
+		if cell.MineProb != -1.0 {
+			t.Errorf("cell (%d, %d) was modified to MineProb %v", cell.X, cell.Y, cell.MineProb)
+		}
+	}
+	if !reflect.DeepEqual(analysis.Safe, [][2]int{{0, 0}, {1, 0}}) {
+		t.Errorf("unexpected safe cells %v", analysis.Safe)
+	}
+	if !reflect.DeepEqual(analysis.Mines, [][2]int{{2, 0}}) {
+		t.Errorf("unexpected mines %v", analysis.Mines)
+	}
+	if analysis.Probabilities[[2]int{3, 1}] != 0.5 {
+		t.Errorf("cell (3, 1) has probability %v, expected 0.5", analysis.Probabilities[[2]int{3, 1}])
+	}
+}
+
+func TestAnalyzeConcurrent(t *testing.T) {
+	mf := parseField(t,
+		"?????",
+		"1?1??",
+	)
+	mf.Minecount = 2
+	expected, err := Analyze(mf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			analysis, err := Analyze(mf)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if !reflect.DeepEqual(analysis, expected) {
+				t.Errorf("concurrent analysis differs: %v", analysis)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestAnalyzeContradiction(t *testing.T) {
+	// The 4 only has three neighbors; the 1 is still solved.
+	mf := parseField(t,
+		"?????",
+		"?????",
+		"4???1",
+	)
+	analysis, err := Analyze(mf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(analysis.Contradictions) != 1 {
+		t.Fatalf("found %d contradictions, expected 1", len(analysis.Contradictions))
+	}
+	if !reflect.DeepEqual(analysis.Contradictions[0].Witnesses, [][2]int{{0, 2}}) {
+		t.Errorf("unexpected contradicting witnesses %v", analysis.Contradictions[0].Witnesses)
+	}
+	if _, ok := analysis.Probabilities[[2]int{1, 1}]; ok {
+		t.Errorf("contradicted cell (1, 1) has a probability")
+	}
+	if analysis.Probabilities[[2]int{4, 1}] != 1.0/3 {
+		t.Errorf("cell (4, 1) has probability %v, expected 1/3", analysis.Probabilities[[2]int{4, 1}])
+	}
+}
+
+func TestAnalyzeNil(t *testing.T) {
+	if _, err := Analyze(nil); err == nil {
+		t.Errorf("expected an error analyzing a nil minefield")
+	}
+}
@@ -0,0 +1,75 @@
+package solver
+
+/* Chording.
+ *
+ * Once a witness has as many flags around it as its number, a chord on it
+ * probes all of its other unprobed neighbors at once. When the solver has
+ * decided a whole region, a few chords clear it in far fewer moves than
+ * probing each safe cell on its own.
+ */
+
+// chordActions returns the flags, followed by chords on witnesses which would
+// open two or more of the probes, followed by the probes no chord opens. A
+// witness is only chorded when every flag around it is either among flags or
+// already placed and not contradicted by probes, so that the chord can't
+// open a mine.
+func chordActions(mf *Minefield, flags, probes []Action) []Action {
+	flagged := map[[2]int]bool{}
+	for _, cell := range mf.Cells {
+		if cell.Flagged {
+			flagged[[2]int{cell.X, cell.Y}] = true
+		}
+	}
+	for _, a := range flags {
+		flagged[a.Cell] = true
+	}
+	safe, pending := map[[2]int]bool{}, map[[2]int]bool{}
+	for _, a := range probes {
+		safe[a.Cell] = true
+		pending[a.Cell] = true
+		if flagged[a.Cell] {
+			// a wrong flag would make any chord next to it explode
+			return append(flags, probes...)
+		}
+	}
+
+	actions := append([]Action{}, flags...)
+	for _, witness := range GetWitnesses(mf) {
+		opens := [][2]int{}
+		around := 0
+		ok := true
+		for _, neighbor := range witness.Neighbors {
+			if neighbor == nil || neighbor.Probed {
+				continue
+			}
+			xy := [2]int{neighbor.X, neighbor.Y}
+			if flagged[xy] {
+				around += 1
+			} else if pending[xy] {
+				opens = append(opens, xy)
+			} else if !safe[xy] {
+				ok = false
+			}
+		}
+		if !ok || around != witness.MineTouch || len(opens) < 2 {
+			continue
+		}
+		for _, xy := range opens {
+			delete(pending, xy)
+		}
+		actions = append(actions, Action{
+			Kind: ActionChord,
+			Cell: [2]int{witness.X, witness.Y},
+			Justification: Justification{
+				Rule:      RuleSaturation,
+				Witnesses: [][2]int{{witness.X, witness.Y}},
+			},
+		})
+	}
+	for _, a := range probes {
+		if pending[a.Cell] {
+			actions = append(actions, a)
+		}
+	}
+	return actions
+}
@@ -0,0 +1,52 @@
+package solver
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExactStrategyChords(t *testing.T) {
+	mf := parseField(t,
+		"?????",
+		"11211",
+		".....",
+	)
+	actions, err := ExactStrategy{}.NextActions(mf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := []string{}
+	for _, a := range actions {
+		found = append(found, string(a.Kind)+" "+formatCoords([][2]int{a.Cell}))
+	}
+	// the 1 at (1, 1) sees one mine and two safe cells, so one chord opens
+	// both; (4, 0) is only opened by the 1 at (3, 1) with (2, 0)
+	expected := []string{
+		"flag (1, 0)",
+		"flag (3, 0)",
+		"chord (1, 1)",
+		"probe (4, 0)",
+	}
+	if !reflect.DeepEqual(found, expected) {
+		t.Errorf("expected actions %v, found %v", expected, found)
+	}
+}
+
+func TestChordSkipsWrongFlags(t *testing.T) {
+	mf := parseField(t,
+		"F????",
+		"11211",
+		".....",
+	)
+	flags := []Action{{Kind: ActionFlag, Cell: [2]int{1, 0}}, {Kind: ActionFlag, Cell: [2]int{3, 0}}}
+	probes := []Action{
+		{Kind: ActionProbe, Cell: [2]int{0, 0}},
+		{Kind: ActionProbe, Cell: [2]int{2, 0}},
+		{Kind: ActionProbe, Cell: [2]int{4, 0}},
+	}
+	for _, a := range chordActions(mf, flags, probes) {
+		if a.Kind == ActionChord {
+			t.Errorf("chord %v next to a wrong flag", a.Cell)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package solver
+
+/* The frontier of a board is usually several islands of primed cells which
+ * don't constrain each other at all: a mine on one island says nothing about
+ * the cells of another. Searching them as one space makes the work grow with
+ * the product of the islands' sizes, so we split them apart first and solve
+ * each one on its own.
+ */
+
+// A Component is a set of primed cells together with the witnesses that
+// constrain them. Two primed cells are in the same Component when they are
+// connected through a chain of shared witnesses, so the cells of different
+// Components can be solved independently.
+type Component struct {
+	Cells     []*Cell
+	Witnesses []*Cell
+}
+
+// SplitComponents partitions primed cells and their witnesses into connected
+// Components. Witnesses which touch none of the primed cells are dropped.
+// Cells keep the relative order they had in primed, and Components are
+// ordered by their first cell.
+func SplitComponents(witnesses []*Cell, primed []*Cell) []Component {
+	// parent forms a union-find forest over the indexes of primed
+	index := map[[2]int]int{}
+	parent := make([]int, len(primed))
+	for idx, cell := range primed {
+		index[[2]int{cell.X, cell.Y}] = idx
+		parent[idx] = idx
+	}
+	var find func(idx int) int
+	find = func(idx int) int {
+		if parent[idx] != idx {
+			parent[idx] = find(parent[idx])
+		}
+		return parent[idx]
+	}
+
+	// link every primed neighbor of a witness to the first one found
+	witnessRoots := make([]int, len(witnesses))
+	for w, witness := range witnesses {
+		witnessRoots[w] = -1
+		for _, neighbor := range witness.Neighbors {
+			if neighbor == nil {
+				continue
+			}
+			idx, ok := index[[2]int{neighbor.X, neighbor.Y}]
+			if !ok {
+				continue
+			}
+			if witnessRoots[w] == -1 {
+				witnessRoots[w] = idx
+				continue
+			}
+			a, b := find(witnessRoots[w]), find(idx)
+			if a != b {
+				parent[b] = a
+			}
+		}
+	}
+
+	components := []Component{}
+	rootComponent := map[int]int{}
+	for idx, cell := range primed {
+		root := find(idx)
+		ci, ok := rootComponent[root]
+		if !ok {
+			ci = len(components)
+			rootComponent[root] = ci
+			components = append(components, Component{})
+		}
+		components[ci].Cells = append(components[ci].Cells, cell)
+	}
+	for w, witness := range witnesses {
+		if witnessRoots[w] == -1 {
+			continue
+		}
+		ci := rootComponent[find(witnessRoots[w])]
+		components[ci].Witnesses = append(components[ci].Witnesses, witness)
+	}
+	return components
+}
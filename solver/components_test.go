@@ -0,0 +1,43 @@
+package solver
+
+import "testing"
+
+func TestSplitComponents(t *testing.T) {
+	// Two islands of primed cells, on the left and right, separated by
+	// cleared cells that touch no mines.
+	mf := parseField(t,
+		"??...??",
+		"1?...?1",
+		"1?...?2",
+	)
+	components := SplitComponents(GetWitnesses(mf), frontierCells(mf))
+	if len(components) != 2 {
+		t.Fatalf("found %d components, expected 2", len(components))
+	}
+	for _, component := range components {
+		if len(component.Witnesses) != 2 {
+			t.Errorf("component has %d witnesses, expected 2", len(component.Witnesses))
+		}
+		left := component.Cells[0].X < 3
+		for _, cell := range component.Cells {
+			if (cell.X < 3) != left {
+				t.Errorf("cell (%d, %d) is in the wrong component", cell.X, cell.Y)
+			}
+		}
+	}
+}
+
+func TestSplitComponentsSharedWitness(t *testing.T) {
+	// The 1 in the middle touches both sides, joining them.
+	mf := parseField(t,
+		"???",
+		"?1?",
+	)
+	components := SplitComponents(GetWitnesses(mf), frontierCells(mf))
+	if len(components) != 1 {
+		t.Fatalf("found %d components, expected 1", len(components))
+	}
+	if len(components[0].Cells) != 5 {
+		t.Errorf("component has %d cells, expected 5", len(components[0].Cells))
+	}
+}
@@ -0,0 +1,307 @@
+package solver
+
+import "math"
+
+/* Exact enumeration of the frontier.
+ *
+ * Every probed cell bordering unprobed cells is a constraint: exactly
+ * MineTouch of its unprobed neighbors contain a mine. Instead of averaging
+ * the ratio each witness reports (which is wrong whenever witnesses share
+ * cells), we walk every assignment of mine/no-mine to the primed cells,
+ * pruning as soon as a witness can no longer be satisfied, and count in how
+ * many of the satisfying assignments each cell holds a mine. Each connected
+ * Component of the frontier is enumerated on its own, unless it is too large
+ * to enumerate in reasonable time, in which case its probabilities are only
+ * estimated.
+ */
+
+// ExactFieldProbability sets MineProb of each primed cell to the fraction of
+// witness-satisfying mine configurations in which that cell contains a mine.
+// Probed cells get a MineProb of 0.0, the same as with GetPrimedCells.
+//
+// If the Minecount of the minefield is known, each frontier configuration is
+// weighted by the number of ways to place the remaining mines among the
+// unconstrained (interior) cells, and the interior cells are given a
+// probability as well. Otherwise every configuration counts the same and
+// interior cells keep a MineProb of -1.0.
+//
+// It returns an error if no configuration can satisfy the witnesses. Use
+// Analyze to get the same probabilities without modifying the minefield.
+func ExactFieldProbability(mf *Minefield) error {
+	analysis, err := Analyze(mf)
+	if err != nil {
+		return err
+	}
+	if len(analysis.Contradictions) > 0 {
+		return analysis.Contradictions[0]
+	}
+	analysis.Apply(mf)
+	return nil
+}
+
+// GetUnconstrainedCells returns the unprobed cells which don't border any
+// probed cell. Nothing is known about them besides the total mine count.
+func GetUnconstrainedCells(mf *Minefield) []*Cell {
+	interior := []*Cell{}
+	for _, cell := range mf.Cells {
+		if cell.Probed {
+			continue
+		}
+		constrained := false
+		for _, neighbor := range cell.Neighbors {
+			if neighbor != nil && neighbor.Probed {
+				constrained = true
+				break
+			}
+		}
+		if !constrained {
+			interior = append(interior, cell)
+		}
+	}
+	return interior
+}
+
+// frontierCells returns the unprobed cells bordering at least one probed cell,
+// sorted by their (Y, X) coordinates. Unlike GetPrimedCells, it does not
+// modify any cell.
+func frontierCells(mf *Minefield) []*Cell {
+	primed := []*Cell{}
+	for _, cell := range mf.Cells {
+		if cell.Probed {
+			continue
+		}
+		for _, neighbor := range cell.Neighbors {
+			if neighbor != nil && neighbor.Probed {
+				primed = append(primed, cell)
+				break
+			}
+		}
+	}
+	return primed
+}
+
+// frontierWitnesses returns every probed cell that has at least one unprobed
+// neighbor. Unlike GetWitnesses this includes cells touching zero mines, since
+// their unprobed neighbors are known to be safe.
+func frontierWitnesses(mf *Minefield) []*Cell {
+	witnesses := []*Cell{}
+	for _, cell := range mf.Cells {
+		if !cell.Probed || cell.MineTouch < 0 {
+			continue
+		}
+		for _, neighbor := range cell.Neighbors {
+			if neighbor != nil && !neighbor.Probed {
+				witnesses = append(witnesses, cell)
+				break
+			}
+		}
+	}
+	return witnesses
+}
+
+// maxComponentCells is the most cells a Component may have to be enumerated,
+// and maxEnumerationSteps the most steps the search of one may take. The
+// number of configurations can grow exponentially with the size of a
+// Component, so a wide frontier that never splits apart could take minutes to
+// enumerate. Components over either limit are estimated with
+// estimateComponent instead. Pruning keeps the Components of real boards far
+// below the step limit even when they have a hundred cells.
+const (
+	maxComponentCells   = 128
+	maxEnumerationSteps = 1 << 22
+)
+
+// estimateComponent estimates the mine probability of each cell of a
+// Component too large to enumerate, the way the heuristic strategy does: each
+// witness of a cell reports the fraction of its unprobed neighbors holding
+// mines, and the cell gets the average. A witness which reports that all, or
+// none, of its unprobed neighbors are mines settles the cell on its own. The
+// estimates are indexed like component.Cells, and no cell is modified.
+func estimateComponent(component Component) []float64 {
+	probs := make([]float64, len(component.Cells))
+	for idx, cell := range component.Cells {
+		sum, count := 0.0, 0
+		safe, mine := false, false
+		for _, witness := range cell.Neighbors {
+			if witness == nil || !witness.Probed || witness.MineTouch < 0 {
+				continue
+			}
+			open := 0
+			for _, neighbor := range witness.Neighbors {
+				if neighbor != nil && !neighbor.Probed {
+					open += 1
+				}
+			}
+			prob := float64(witness.MineTouch) / float64(open)
+			safe = safe || prob <= 0.0
+			mine = mine || prob >= 1.0
+			sum += prob
+			count += 1
+		}
+		switch {
+		case safe:
+			probs[idx] = 0.0
+		case mine:
+			probs[idx] = 1.0
+		default:
+			probs[idx] = sum / float64(count)
+		}
+	}
+	return probs
+}
+
+// estimatedDistribution is a stand-in for the enumerated distribution of a
+// Component whose probabilities were estimated: every configuration is taken
+// to place the expected number of mines, so that the mine count can still be
+// shared out between it and the rest of the board.
+func estimatedDistribution(probs []float64) mineDistribution {
+	expected := 0.0
+	for _, prob := range probs {
+		expected += prob
+	}
+	k := int(math.Round(expected))
+	dist := mineDistribution{totals: make([]uint64, k+1), mines: make([][]uint64, len(probs))}
+	dist.totals[k] = 1
+	for idx := range probs {
+		dist.mines[idx] = make([]uint64, k+1)
+	}
+	return dist
+}
+
+// enumerateFrontier counts the mine configurations of primed that satisfy all
+// witnesses, grouped by how many mines they place. totals[k] is the number of
+// satisfying configurations with k mines, and mines[idx][k] is the number of
+// those in which the cell primed[idx] holds a mine. Every unprobed neighbor
+// of the witnesses must be in primed. It gives up, returning false, once the
+// search takes more than maxEnumerationSteps steps.
+func enumerateFrontier(witnesses []*Cell, primed []*Cell) (totals []uint64, mines [][]uint64, ok bool) {
+	index := map[[2]int]int{}
+	for idx, cell := range primed {
+		index[[2]int{cell.X, cell.Y}] = idx
+	}
+	// need is the number of mines each witness still requires, open the
+	// number of its unprobed neighbors that are not yet assigned
+	need := make([]int, len(witnesses))
+	open := make([]int, len(witnesses))
+	cellWitnesses := make([][]int, len(primed))
+	for w, witness := range witnesses {
+		need[w] = witness.MineTouch
+		for _, neighbor := range witness.Neighbors {
+			if neighbor == nil || neighbor.Probed {
+				continue
+			}
+			open[w] += 1
+			if idx, ok := index[[2]int{neighbor.X, neighbor.Y}]; ok {
+				cellWitnesses[idx] = append(cellWitnesses[idx], w)
+			}
+		}
+	}
+	totals = make([]uint64, len(primed)+1)
+	mines = make([][]uint64, len(primed))
+	for idx := range primed {
+		mines[idx] = make([]uint64, len(primed)+1)
+	}
+	for w := range witnesses {
+		if need[w] < 0 || need[w] > open[w] {
+			return totals, mines, true
+		}
+	}
+
+	order := searchOrder(primed, cellWitnesses)
+	assigned := make([]bool, len(primed))
+	placed := 0
+
+	// place assigns a value to the cell at idx and reports whether every
+	// witness of that cell can still be satisfied afterwards
+	place := func(idx int, mine bool) bool {
+		ok := true
+		for _, w := range cellWitnesses[idx] {
+			open[w] -= 1
+			if mine {
+				need[w] -= 1
+			}
+			if need[w] < 0 || need[w] > open[w] {
+				ok = false
+			}
+		}
+		return ok
+	}
+	unplace := func(idx int, mine bool) {
+		for _, w := range cellWitnesses[idx] {
+			open[w] += 1
+			if mine {
+				need[w] += 1
+			}
+		}
+	}
+	steps := 0
+	var search func(depth int)
+	search = func(depth int) {
+		steps += 1
+		if steps > maxEnumerationSteps {
+			return
+		}
+		if depth == len(order) {
+			totals[placed] += 1
+			for idx, mine := range assigned {
+				if mine {
+					mines[idx][placed] += 1
+				}
+			}
+			return
+		}
+		idx := order[depth]
+		for _, mine := range []bool{false, true} {
+			assigned[idx] = mine
+			if mine {
+				placed += 1
+			}
+			if place(idx, mine) {
+				search(depth + 1)
+			}
+			unplace(idx, mine)
+			if mine {
+				placed -= 1
+			}
+		}
+		assigned[idx] = false
+	}
+	search(0)
+	return totals, mines, steps <= maxEnumerationSteps
+}
+
+// searchOrder orders the primed cells so that cells sharing a witness are
+// assigned close together, which lets enumerateFrontier prune early. Cells
+// are visited breadth-first through their shared witnesses, starting from
+// each not-yet-visited cell in the order given.
+func searchOrder(primed []*Cell, cellWitnesses [][]int) []int {
+	witnessCells := map[int][]int{}
+	for idx, ws := range cellWitnesses {
+		for _, w := range ws {
+			witnessCells[w] = append(witnessCells[w], idx)
+		}
+	}
+	seen := make([]bool, len(primed))
+	order := []int{}
+	for start := range primed {
+		if seen[start] {
+			continue
+		}
+		seen[start] = true
+		queue := []int{start}
+		for len(queue) > 0 {
+			idx := queue[0]
+			queue = queue[1:]
+			order = append(order, idx)
+			for _, w := range cellWitnesses[idx] {
+				for _, other := range witnessCells[w] {
+					if !seen[other] {
+						seen[other] = true
+						queue = append(queue, other)
+					}
+				}
+			}
+		}
+	}
+	return order
+}
@@ -0,0 +1,230 @@
+package solver
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+// parseField builds a Minefield from rows of characters: a digit is a probed
+// cell touching that many mines, '.' is a probed cell touching none, '?' is an
+// unprobed cell and 'F' is a flagged unprobed cell.
+func parseField(t *testing.T, rows ...string) *Minefield {
+	t.Helper()
+	mf := Minefield{Height: len(rows), Width: len(rows[0])}
+	for y, row := range rows {
+		if len(row) != mf.Width {
+			t.Fatalf("row %d has width %d, expected %d", y, len(row), mf.Width)
+		}
+		for x, ch := range row {
+			c := &Cell{
+				MineProb:  -1.0,
+				MineTouch: -1,
+				X:         x,
+				Y:         y,
+				Neighbors: map[string]*Cell{},
+			}
+			switch {
+			case ch == '.':
+				c.Probed = true
+				c.MineTouch = 0
+			case ch >= '0' && ch <= '8':
+				c.Probed = true
+				c.MineTouch = int(ch - '0')
+			case ch == 'F':
+				c.Flagged = true
+			case ch == '?':
+			default:
+				t.Fatalf("unknown cell %q at (%d, %d)", ch, x, y)
+			}
+			mf.Cells = append(mf.Cells, c)
+		}
+	}
+	deltas := map[string][]int{
+		"N":  []int{0, -1},
+		"S":  []int{0, 1},
+		"W":  []int{-1, 0},
+		"E":  []int{1, 0},
+		"NW": []int{-1, -1},
+		"NE": []int{1, -1},
+		"SW": []int{-1, 1},
+		"SE": []int{1, 1},
+	}
+	for _, c := range mf.Cells {
+		for direction, delta := range deltas {
+			X, Y := c.X+delta[0], c.Y+delta[1]
+			if X < 0 || X >= mf.Width || Y < 0 || Y >= mf.Height {
+				c.Neighbors[direction] = nil
+				continue
+			}
+			c.Neighbors[direction] = mf.Cells[X+Y*mf.Width]
+		}
+	}
+	return &mf
+}
+
+func expectProbs(t *testing.T, mf *Minefield, expected map[[2]int]float64) {
+	t.Helper()
+	for xy, prob := range expected {
+		cell := mf.Cells[xy[0]+xy[1]*mf.Width]
+		if math.Abs(cell.MineProb-prob) > 1e-9 {
+			t.Errorf("cell (%d, %d) has MineProb %v, expected %v", xy[0], xy[1], cell.MineProb, prob)
+		}
+	}
+}
+
+func TestExactFieldProbabilityOverlap(t *testing.T) {
+	// The 1-2-1 pattern: averaging witnesses calls every cell uncertain, but
+	// the only configuration puts mines on both ends.
+	mf := parseField(t,
+		"???",
+		"121",
+	)
+	if err := ExactFieldProbability(mf); err != nil {
+		t.Fatal(err)
+	}
+	expectProbs(t, mf, map[[2]int]float64{
+		{0, 0}: 1.0,
+		{1, 0}: 0.0,
+		{2, 0}: 1.0,
+		{0, 1}: 0.0,
+	})
+}
+
+func TestExactFieldProbabilityShared(t *testing.T) {
+	// The zero clears (0,0) and (1,0), so the 1 forces a mine at (2,0) and
+	// the 2 splits its remaining mine between (3,0) and (3,1).
+	mf := parseField(t,
+		"????",
+		".12?",
+	)
+	if err := ExactFieldProbability(mf); err != nil {
+		t.Fatal(err)
+	}
+	expectProbs(t, mf, map[[2]int]float64{
+		{0, 0}: 0.0,
+		{1, 0}: 0.0,
+		{2, 0}: 1.0,
+		{3, 0}: 0.5,
+		{3, 1}: 0.5,
+	})
+}
+
+func TestExactFieldProbabilityUniform(t *testing.T) {
+	mf := parseField(t,
+		"??",
+		"1?",
+	)
+	if err := ExactFieldProbability(mf); err != nil {
+		t.Fatal(err)
+	}
+	expectProbs(t, mf, map[[2]int]float64{
+		{0, 0}: 1.0 / 3,
+		{1, 0}: 1.0 / 3,
+		{1, 1}: 1.0 / 3,
+	})
+}
+
+func TestExactFieldProbabilityContradiction(t *testing.T) {
+	mf := parseField(t,
+		"?",
+		"2",
+	)
+	if err := ExactFieldProbability(mf); err == nil {
+		t.Errorf("expected an error for an unsatisfiable witness")
+	}
+}
+
+func TestExactFieldProbabilityMinecount(t *testing.T) {
+	// The 1 sees three cells, and two more cells are unconstrained. With 2
+	// mines in total, a frontier configuration with one mine leaves one mine
+	// for the two interior cells: each of the 3 frontier configurations
+	// counts C(2, 1) = 2 times.
+	mf := parseField(t,
+		"???",
+		"1??",
+	)
+	// (2,0) and (2,1) don't touch the 1
+	mf.Minecount = 2
+	if err := ExactFieldProbability(mf); err != nil {
+		t.Fatal(err)
+	}
+	expectProbs(t, mf, map[[2]int]float64{
+		{0, 0}: 1.0 / 3,
+		{1, 0}: 1.0 / 3,
+		{1, 1}: 1.0 / 3,
+		{2, 0}: 0.5,
+		{2, 1}: 0.5,
+	})
+	if safest := GetSafestCell(mf); safest.X == 2 {
+		t.Errorf("expected a frontier cell to be safest, found (%d, %d)", safest.X, safest.Y)
+	}
+}
+
+func TestExactFieldProbabilityWeighted(t *testing.T) {
+	// The frontier can hold one or two mines, and (4,0) and (4,1) are
+	// interior cells. Expected values come from counting every board with
+	// exactly 2 mines that agrees with the witnesses; there are 7.
+	mf := parseField(t,
+		"?????",
+		"1?1??",
+	)
+	mf.Minecount = 2
+	if err := ExactFieldProbability(mf); err != nil {
+		t.Fatal(err)
+	}
+	expectProbs(t, mf, map[[2]int]float64{
+		{0, 0}: 3.0 / 7,
+		{1, 0}: 2.0 / 7,
+		{2, 0}: 1.0 / 7,
+		{3, 0}: 1.0 / 7,
+		{1, 1}: 2.0 / 7,
+		{3, 1}: 1.0 / 7,
+		{4, 0}: 2.0 / 7,
+		{4, 1}: 2.0 / 7,
+	})
+}
+
+func TestAnalyzeEstimatesLargeComponents(t *testing.T) {
+	// every 2 sees three cells above it and three below, so the frontier
+	// is one component with far too many configurations to count: one
+	// over the cell limit, and one within it which takes too many steps
+	for _, width := range []int{200, 60} {
+		mf := parseField(t,
+			strings.Repeat("?", width),
+			strings.Repeat("2", width),
+			strings.Repeat("?", width),
+			strings.Repeat("?", width),
+		)
+		mf.Minecount = width * 5 / 4
+		done := make(chan Analysis)
+		go func() {
+			analysis, err := Analyze(mf)
+			if err != nil {
+				t.Error(err)
+			}
+			done <- analysis
+		}()
+		var analysis Analysis
+		select {
+		case analysis = <-done:
+		case <-time.After(10 * time.Second):
+			t.Fatalf("width %d: analysis of a large component didn't finish", width)
+		}
+		if analysis.Configurations != nil {
+			t.Errorf("width %d: estimated analysis claims %v configurations", width, analysis.Configurations)
+		}
+		for x := 0; x < width; x++ {
+			xy := [2]int{x, 0}
+			j := analysis.Justifications[xy]
+			if j.Rule != RuleHeuristic || j.Probability <= 0.0 || j.Probability >= 1.0 {
+				t.Fatalf("width %d: cell %v got %v", width, xy, j)
+			}
+		}
+		// the interior cells still share out the mines left over
+		if prob := analysis.Probabilities[[2]int{0, 3}]; prob <= 0.0 || prob >= 1.0 {
+			t.Errorf("width %d: interior cell has probability %v", width, prob)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package solver
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+const (
+	// The cell's probability comes from enumerating every configuration of
+	// its component of the frontier (see Analyze).
+	RuleEnumeration Rule = "enumeration"
+	// The cell is unconstrained, so its probability only comes from the
+	// number of mines left over once the frontier is filled in.
+	RuleMineCount Rule = "mine count"
+)
+
+// A Justification records why the solver believes what it does about a cell:
+// the rule or method used and the witnesses it relied on. Probabilities come
+// with the counts they were calculated from. Justifications are meant to be
+// read by people reviewing a game, either printed with String or serialized
+// to JSON.
+type Justification struct {
+	Rule Rule `json:"rule"`
+	// Witnesses are the coordinates of the witnesses which were used.
+	Witnesses [][2]int `json:"witnesses"`
+	// Configurations is the number of mine configurations considered, and
+	// MineConfigurations the number of those in which the cell holds a
+	// mine. When the mine count of the board is known these count complete
+	// boards; otherwise they count configurations of the cell's component.
+	// Both are nil for deterministic rules.
+	Configurations     *big.Int `json:"configurations,omitempty"`
+	MineConfigurations *big.Int `json:"mine_configurations,omitempty"`
+	// Probability is the probability that the cell holds a mine.
+	Probability float64 `json:"probability"`
+}
+
+func (j Justification) String() string {
+	rv := string(j.Rule)
+	if len(j.Witnesses) > 0 {
+		rv += " from witnesses " + formatCoords(j.Witnesses)
+	}
+	if j.Configurations != nil && j.MineConfigurations != nil {
+		rv += fmt.Sprintf("; mine in %v of %v configurations", j.MineConfigurations, j.Configurations)
+	}
+	rv += fmt.Sprintf(" (%.1f%%)", j.Probability*100)
+	return rv
+}
+
+func (d Deduction) String() string {
+	contents := "safe"
+	if d.Mine {
+		contents = "mine"
+	}
+	return fmt.Sprintf("%s at (%d, %d) by %v", contents, d.Cell[0], d.Cell[1], d.Justification)
+}
+
+// formatCoords formats coordinates the same way main.go prints them.
+func formatCoords(coords [][2]int) string {
+	parts := make([]string, len(coords))
+	for idx, xy := range coords {
+		parts[idx] = fmt.Sprintf("(%d, %d)", xy[0], xy[1])
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,55 @@
+package solver
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestJustificationJSON(t *testing.T) {
+	mf := parseField(t,
+		"????",
+		".12?",
+	)
+	analysis, err := Analyze(mf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	why, ok := analysis.Justifications[[2]int{3, 0}]
+	if !ok {
+		t.Fatalf("cell (3, 0) has no justification")
+	}
+	if why.Rule != RuleEnumeration || why.Configurations.Int64() != 2 || why.MineConfigurations.Int64() != 1 {
+		t.Errorf("unexpected justification %+v", why)
+	}
+	data, err := json.Marshal(Deduction{Cell: [2]int{3, 0}, Justification: why})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"cell", "mine", "rule", "witnesses", "configurations", "mine_configurations", "probability"} {
+		if _, ok := decoded[key]; !ok {
+			t.Errorf("serialized deduction %s is missing %q", data, key)
+		}
+	}
+}
+
+func TestDeductionString(t *testing.T) {
+	mf := parseField(t,
+		"???",
+		"121",
+	)
+	deductions := ApplyRules(mf)
+	if len(deductions) == 0 {
+		t.Fatalf("no deductions made")
+	}
+	text := deductions[0].String()
+	for _, part := range []string{"(0, 1)", "(1, 1)", "(2, 1)", string(RuleOneTwoOne)} {
+		if !strings.Contains(text, part) {
+			t.Errorf("explanation %q doesn't mention %q", text, part)
+		}
+	}
+}
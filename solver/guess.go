@@ -0,0 +1,167 @@
+package solver
+
+import "sort"
+
+/* Choosing a guess.
+ *
+ * When no cell is certainly safe, the cell least likely to be a mine isn't
+ * always the best one to probe. Surviving a probe whose number decides
+ * nothing only leads to another guess, so it can be worth a little more risk
+ * to probe a cell whose number is likely to open up the board.
+ *
+ * A guess is scored by trying every number the cell could show: the cell is
+ * marked probed with that number and the board analyzed again. The number of
+ * complete boards agreeing with each outcome, out of the boards agreeing with
+ * the board as it is, is the chance of that outcome. From the outcomes come
+ * the chance the cell shows a zero, the expected number of cells its number
+ * decides, and the chance that the guess is survived with a safe cell to
+ * probe next, which is the chance the guess moves the game forward without
+ * another guess.
+ */
+
+const (
+	// guessTolerance is how much of the safest cell's chance of being safe
+	// a candidate guess may give up for the information it would reveal.
+	guessTolerance = 0.95
+	// maxGuessCandidates bounds the number of candidates scored, since each
+	// costs an Analyze for every number it could show.
+	maxGuessCandidates = 24
+)
+
+// A guessScore describes what probing a cell is expected to lead to.
+type guessScore struct {
+	// safe is the chance the cell is safe, and progress the chance it is
+	// safe and its number leaves a safe cell to probe next.
+	safe     float64
+	progress float64
+	// zero is the chance the cell shows a zero, opening its neighbors.
+	zero float64
+	// resolved is the expected number of cells decided by its number.
+	resolved float64
+}
+
+// better reports whether probing with score s is preferred to o: the more
+// likely to make progress, then the more cells decided, then the more likely
+// to show a zero, then the safer.
+func (s guessScore) better(o guessScore) bool {
+	for _, pair := range [][2]float64{
+		{s.progress, o.progress},
+		{s.resolved, o.resolved},
+		{s.zero, o.zero},
+		{s.safe, o.safe},
+	} {
+		if pair[0]-pair[1] > epsilon {
+			return true
+		} else if pair[1]-pair[0] > epsilon {
+			return false
+		}
+	}
+	return false
+}
+
+// informativeProbe chooses the guess with the best guessScore among the
+// cells nearly as safe as the safest one. Scoring needs the number of
+// complete boards, so without a known Minecount it settles for the cell with
+// the most unprobed neighbors among the safest ones.
+func informativeProbe(mf *Minefield, analysis Analysis) (Action, error) {
+	safest := GetSafestCell(mf)
+	if safest == nil {
+		return firstUnmarked(mf)
+	}
+	best := safest
+	if analysis.Configurations == nil {
+		best = mostNeighbors(mf, safest.MineProb)
+	} else {
+		bestScore := guessScore{}
+		for _, cell := range guessCandidates(mf, safest.MineProb) {
+			score := scoreGuess(mf, cell, analysis)
+			if score.better(bestScore) {
+				best, bestScore = cell, score
+			}
+		}
+	}
+	xy := [2]int{best.X, best.Y}
+	return Action{Kind: ActionProbe, Cell: xy, Justification: analysis.Justifications[xy]}, nil
+}
+
+// guessCandidates returns the unmarked cells whose chance of being safe is
+// within guessTolerance of the safest cell's, safest first. Among equally
+// safe cells, those with fewer unprobed neighbors come first, since their
+// numbers are more likely to be zero or to decide something.
+func guessCandidates(mf *Minefield, lowest float64) []*Cell {
+	candidates := []*Cell{}
+	for _, cell := range GetUnmarkedCells(mf) {
+		if cell.MineProb == -1.0 || 1-cell.MineProb < (1-lowest)*guessTolerance {
+			continue
+		}
+		candidates = append(candidates, cell)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.MineProb != b.MineProb {
+			return a.MineProb < b.MineProb
+		}
+		return unprobedNeighbors(a) < unprobedNeighbors(b)
+	})
+	if len(candidates) > maxGuessCandidates {
+		candidates = candidates[:maxGuessCandidates]
+	}
+	return candidates
+}
+
+// scoreGuess scores probing cell by analyzing the board once for every number
+// it could show. Each number is tried on a copy of mf, which is left as it
+// is.
+func scoreGuess(mf *Minefield, cell *Cell, analysis Analysis) guessScore {
+	score := guessScore{}
+	known := len(analysis.Safe) + len(analysis.Mines)
+	hypothetical := mf.Copy()
+	revealed := hypothetical.Cells[cell.X+cell.Y*mf.Width]
+	revealed.Probed = true
+	for n := 0; n <= unprobedNeighbors(cell); n++ {
+		revealed.MineTouch = n
+		outcome, err := Analyze(hypothetical)
+		if err != nil || outcome.Configurations == nil {
+			continue
+		}
+		chance := ratio(outcome.Configurations, analysis.Configurations)
+		if chance == 0.0 {
+			continue
+		}
+		score.safe += chance
+		if n == 0 {
+			score.zero = chance
+		}
+		if len(outcome.Safe) > 0 {
+			score.progress += chance
+		}
+		score.resolved += chance * float64(len(outcome.Safe)+len(outcome.Mines)-known)
+	}
+	return score
+}
+
+// mostNeighbors returns, among the unmarked cells with a MineProb of lowest,
+// the one with the most unprobed neighbors, since its number constrains the
+// most cells.
+func mostNeighbors(mf *Minefield, lowest float64) *Cell {
+	var best *Cell
+	for _, cell := range GetUnmarkedCells(mf) {
+		if cell.MineProb == -1.0 || cell.MineProb-lowest > epsilon {
+			continue
+		}
+		if best == nil || unprobedNeighbors(cell) > unprobedNeighbors(best) {
+			best = cell
+		}
+	}
+	return best
+}
+
+func unprobedNeighbors(cell *Cell) int {
+	count := 0
+	for _, neighbor := range cell.Neighbors {
+		if neighbor != nil && !neighbor.Probed {
+			count += 1
+		}
+	}
+	return count
+}
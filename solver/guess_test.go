@@ -0,0 +1,64 @@
+package solver
+
+import (
+	"math"
+	"testing"
+)
+
+func TestScoreGuess(t *testing.T) {
+	mf := parseField(t,
+		"1???",
+		"????",
+		"????",
+	)
+	mf.Minecount = 3
+	analysis, err := Analyze(mf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	analysis.Apply(mf)
+	for _, cell := range GetUnmarkedCells(mf) {
+		score := scoreGuess(mf, cell, analysis)
+		if cell.Probed || cell.MineTouch != -1 {
+			t.Fatalf("scoring changed cell (%d, %d)", cell.X, cell.Y)
+		}
+		if math.Abs(score.safe-(1-cell.MineProb)) > epsilon {
+			t.Errorf("cell (%d, %d) safe %v, expected %v", cell.X, cell.Y, score.safe, 1-cell.MineProb)
+		}
+		if score.zero > score.progress+epsilon || score.progress > score.safe+epsilon {
+			t.Errorf("cell (%d, %d) zero %v, progress %v, safe %v out of order", cell.X, cell.Y, score.zero, score.progress, score.safe)
+		}
+	}
+}
+
+func TestInfoGainGuessWithinTolerance(t *testing.T) {
+	mf := parseField(t,
+		"1???",
+		"????",
+		"????",
+	)
+	mf.Minecount = 3
+	actions, err := InfoGainStrategy{}.NextActions(mf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	guess := actions[len(actions)-1]
+	if !guess.Guess() {
+		t.Fatalf("expected a guess, found %v", guess)
+	}
+	lowest := GetSafestCell(mf).MineProb
+	if 1-guess.Probability < (1-lowest)*guessTolerance {
+		t.Errorf("guess %v is much riskier than the safest cell at %v", guess, lowest)
+	}
+}
+
+func TestGuessScoreBetter(t *testing.T) {
+	safer := guessScore{safe: 0.9, progress: 0.3, resolved: 2}
+	riskier := guessScore{safe: 0.8, progress: 0.5, resolved: 1}
+	if !riskier.better(safer) || safer.better(riskier) {
+		t.Errorf("progress should outweigh safety")
+	}
+	if safer.better(safer) {
+		t.Errorf("a score should not be better than itself")
+	}
+}
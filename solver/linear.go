@@ -0,0 +1,168 @@
+package solver
+
+import "math"
+
+/* Linear-algebra deductions.
+ *
+ * Each witness is an equation over the primed cells around it: the sum of
+ * their mine indicators (0 or 1) equals the number of mines it still needs.
+ * Putting every witness into one 0/1 matrix, one row per witness and one
+ * column per primed cell, and reducing that matrix with Gaussian elimination
+ * combines witnesses along chains of any length. A reduced row whose right
+ * hand side equals the smallest or largest sum its coefficients can reach
+ * can only be satisfied one way, which decides every cell in that row.
+ */
+
+// epsilon is the tolerance when comparing the floating point values of the
+// reduced matrix; every exact value is a small rational.
+const epsilon = 1e-9
+
+// SolveLinear deduces cells by Gaussian elimination over the witness matrix,
+// repeating the elimination with the deduced cells removed until nothing new
+// is found. It returns every Deduction in the order it was made, each with
+// RuleLinear and the witnesses whose rows were combined to reach it. The
+// minefield is not modified.
+func SolveLinear(mf *Minefield) []Deduction {
+	witnesses := GetWitnesses(mf)
+	primed := frontierCells(mf)
+	known := map[[2]int]bool{}
+	deductions := []Deduction{}
+	for {
+		found := reduceWitnessMatrix(witnesses, primed, known)
+		if len(found) == 0 {
+			break
+		}
+		for _, d := range found {
+			known[d.Cell] = d.Mine
+		}
+		deductions = append(deductions, found...)
+	}
+	return deductions
+}
+
+// A matrixRow is one equation of the witness matrix, along with which
+// witnesses were combined to produce it.
+type matrixRow struct {
+	coefs   []float64
+	rhs     float64
+	sources []bool
+}
+
+// reduceWitnessMatrix builds the matrix of witnesses over the primed cells
+// which aren't known yet, reduces it, and returns the cells decided by the
+// reduced rows.
+func reduceWitnessMatrix(witnesses []*Cell, primed []*Cell, known map[[2]int]bool) []Deduction {
+	columns := []*Cell{}
+	index := map[[2]int]int{}
+	for _, cell := range primed {
+		xy := [2]int{cell.X, cell.Y}
+		if _, ok := known[xy]; !ok {
+			index[xy] = len(columns)
+			columns = append(columns, cell)
+		}
+	}
+	rows := []*matrixRow{}
+	for w, witness := range witnesses {
+		row := &matrixRow{
+			coefs:   make([]float64, len(columns)),
+			rhs:     float64(witness.MineTouch),
+			sources: make([]bool, len(witnesses)),
+		}
+		row.sources[w] = true
+		empty := true
+		for _, neighbor := range witness.Neighbors {
+			if neighbor == nil || neighbor.Probed {
+				continue
+			}
+			xy := [2]int{neighbor.X, neighbor.Y}
+			if mine, ok := known[xy]; ok {
+				if mine {
+					row.rhs -= 1
+				}
+				continue
+			}
+			row.coefs[index[xy]] = 1
+			empty = false
+		}
+		if !empty {
+			rows = append(rows, row)
+		}
+	}
+
+	// reduced row echelon form, pivoting on the largest coefficient
+	pivotRow := 0
+	for col := 0; col < len(columns) && pivotRow < len(rows); col++ {
+		best := pivotRow
+		for r := pivotRow + 1; r < len(rows); r++ {
+			if math.Abs(rows[r].coefs[col]) > math.Abs(rows[best].coefs[col]) {
+				best = r
+			}
+		}
+		if math.Abs(rows[best].coefs[col]) < epsilon {
+			continue
+		}
+		rows[pivotRow], rows[best] = rows[best], rows[pivotRow]
+		pivot := rows[pivotRow]
+		scale := pivot.coefs[col]
+		for c := range pivot.coefs {
+			pivot.coefs[c] /= scale
+		}
+		pivot.rhs /= scale
+		for r, row := range rows {
+			if r == pivotRow || math.Abs(row.coefs[col]) < epsilon {
+				continue
+			}
+			factor := row.coefs[col]
+			for c := range row.coefs {
+				row.coefs[c] -= factor * pivot.coefs[c]
+			}
+			row.rhs -= factor * pivot.rhs
+			for w, source := range pivot.sources {
+				row.sources[w] = row.sources[w] || source
+			}
+		}
+		pivotRow += 1
+	}
+
+	deductions := []Deduction{}
+	decided := map[int]bool{}
+	for _, row := range rows {
+		low, high := 0.0, 0.0
+		for _, coef := range row.coefs {
+			if coef < -epsilon {
+				low += coef
+			} else if coef > epsilon {
+				high += coef
+			}
+		}
+		if low == 0 && high == 0 {
+			continue
+		}
+		// at the lowest sum, negative coefficients are mines and positive
+		// ones safe; at the highest, the other way around
+		var negativeMine bool
+		if math.Abs(row.rhs-low) < epsilon {
+			negativeMine = true
+		} else if math.Abs(row.rhs-high) < epsilon {
+			negativeMine = false
+		} else {
+			continue
+		}
+		sources := []*Cell{}
+		for w, source := range row.sources {
+			if source {
+				sources = append(sources, witnesses[w])
+			}
+		}
+		for col, coef := range row.coefs {
+			if math.Abs(coef) < epsilon || decided[col] {
+				continue
+			}
+			decided[col] = true
+			cell := columns[col]
+			mine := (coef < 0) == negativeMine
+			deductions = append(deductions, newDeduction([2]int{cell.X, cell.Y}, mine, RuleLinear, cellCoords(sources)))
+		}
+	}
+	return deductions
+}
@@ -0,0 +1,66 @@
+package solver
+
+import "testing"
+
+func TestSolveLinearChain(t *testing.T) {
+	// (2,5) is only decided by combining five witnesses along the bottom,
+	// which no pair of witnesses can do on its own.
+	mf := parseField(t,
+		"????????",
+		"????????",
+		"??????2?",
+		"????????",
+		"????1??1",
+		"????????",
+		"?3?31111",
+		"???10000",
+	)
+	var chained *Deduction
+	for _, d := range SolveLinear(mf) {
+		if d.Cell == [2]int{2, 5} {
+			d := d
+			chained = &d
+		}
+	}
+	if chained == nil {
+		t.Fatalf("cell (2, 5) was not deduced")
+	}
+	if !chained.Mine || chained.Rule != RuleLinear {
+		t.Errorf("expected (2, 5) to be a mine by the linear rule, found %+v", *chained)
+	}
+	if len(chained.Witnesses) < 3 {
+		t.Errorf("expected a chain of witnesses, found %v", chained.Witnesses)
+	}
+	for _, d := range ApplyRules(mf) {
+		if d.Cell == [2]int{2, 5} {
+			t.Errorf("pattern rules unexpectedly decided (2, 5)")
+		}
+	}
+}
+
+func TestSolveLinearAgreesWithAnalyze(t *testing.T) {
+	mf := parseField(t,
+		"1??1??10",
+		"?2211110",
+		"?1000000",
+		"?1111000",
+		"????2121",
+		"????????",
+		"12??????",
+		"01??????",
+	)
+	analysis, err := Analyze(mf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deductions := SolveLinear(mf)
+	if len(deductions) == 0 {
+		t.Fatalf("no deductions made")
+	}
+	for _, d := range deductions {
+		prob, ok := analysis.Probabilities[d.Cell]
+		if !ok || (d.Mine && prob != 1.0) || (!d.Mine && prob != 0.0) {
+			t.Errorf("deduction %+v disagrees with probability %v", d, prob)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package solver
+
+import (
+	"errors"
+	"math/big"
+)
+
+/* Weighing frontier configurations by the global mine count.
+ *
+ * A frontier configuration placing k mines leaves (Minecount - k) mines to be
+ * spread over the U unconstrained cells, which can happen in
+ * C(U, Minecount - k) ways. Every complete board is equally likely, so each
+ * frontier configuration counts C(U, Minecount - k) times. Configurations
+ * with fewer mines usually leave many more ways to fill the interior, which
+ * is why they are more likely than a plain count would suggest.
+ */
+
+// A mineDistribution holds the enumerated configurations of one Component,
+// grouped by the number of mines they place (see enumerateFrontier).
+type mineDistribution struct {
+	totals []uint64
+	mines  [][]uint64
+}
+
+func (d mineDistribution) empty() bool {
+	for _, count := range d.totals {
+		if count > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// cellCounts returns the number of configurations in which the cell at idx
+// holds a mine, and the number of configurations in total, without any
+// weighing by mine count.
+func (d mineDistribution) cellCounts(idx int) (*big.Int, *big.Int) {
+	total, mines := uint64(0), uint64(0)
+	for k := range d.totals {
+		total += d.totals[k]
+		mines += d.mines[idx][k]
+	}
+	return new(big.Int).SetUint64(mines), new(big.Int).SetUint64(total)
+}
+
+// weighDistributions combines the distributions of independent components
+// under the constraint that the whole board holds minecount mines, with
+// unconstrained cells left over. Each configuration of the whole board
+// counts once, so the weight of a cell is the number of complete boards in
+// which it holds a mine. It returns the weight of each component cell
+// (indexed like dists), the weight of any one unconstrained cell, and the
+// total number of complete boards.
+func weighDistributions(dists []mineDistribution, unconstrained int, minecount int) ([][]*big.Int, *big.Int, *big.Int, error) {
+	binomials := binomialCache{}
+	// others[ci] is the distribution of mine counts over every component
+	// except ci, built from prefix and suffix convolutions
+	prefix := make([][]*big.Int, len(dists)+1)
+	suffix := make([][]*big.Int, len(dists)+1)
+	prefix[0] = []*big.Int{big.NewInt(1)}
+	suffix[len(dists)] = []*big.Int{big.NewInt(1)}
+	for ci := range dists {
+		prefix[ci+1] = convolve(prefix[ci], bigCounts(dists[ci].totals))
+	}
+	for ci := len(dists) - 1; ci >= 0; ci-- {
+		suffix[ci] = convolve(suffix[ci+1], bigCounts(dists[ci].totals))
+	}
+	all := prefix[len(dists)]
+
+	// total weight of every configuration of the board, and the weight of
+	// those where a given unconstrained cell holds a mine
+	total := new(big.Int)
+	interior := new(big.Int)
+	for k, count := range all {
+		total.Add(total, new(big.Int).Mul(count, binomials.get(unconstrained, minecount-k)))
+		interior.Add(interior, new(big.Int).Mul(count, binomials.get(unconstrained-1, minecount-k-1)))
+	}
+	if total.Sign() == 0 {
+		return nil, nil, nil, errors.New("no mine configuration satisfies the witnesses and the mine count")
+	}
+
+	cellWeights := make([][]*big.Int, len(dists))
+	for ci, dist := range dists {
+		others := convolve(prefix[ci], suffix[ci+1])
+		// weights[k] is the weight of the rest of the board given that
+		// this component places k mines
+		weights := make([]*big.Int, len(dist.totals))
+		for k := range dist.totals {
+			weights[k] = new(big.Int)
+			for o, count := range others {
+				weights[k].Add(weights[k], new(big.Int).Mul(count, binomials.get(unconstrained, minecount-k-o)))
+			}
+		}
+		cellWeights[ci] = make([]*big.Int, len(dist.mines))
+		for idx, mines := range dist.mines {
+			weight := new(big.Int)
+			for k, count := range mines {
+				if count == 0 {
+					continue
+				}
+				weight.Add(weight, new(big.Int).Mul(new(big.Int).SetUint64(count), weights[k]))
+			}
+			cellWeights[ci][idx] = weight
+		}
+	}
+	return cellWeights, interior, total, nil
+}
+
+// convolve returns the distribution of the sum of two independent mine
+// counts, given the number of configurations for each count.
+func convolve(a, b []*big.Int) []*big.Int {
+	rv := make([]*big.Int, len(a)+len(b)-1)
+	for i := range rv {
+		rv[i] = new(big.Int)
+	}
+	for i, x := range a {
+		if x.Sign() == 0 {
+			continue
+		}
+		for j, y := range b {
+			rv[i+j].Add(rv[i+j], new(big.Int).Mul(x, y))
+		}
+	}
+	return rv
+}
+
+func bigCounts(counts []uint64) []*big.Int {
+	rv := make([]*big.Int, len(counts))
+	for i, count := range counts {
+		rv[i] = new(big.Int).SetUint64(count)
+	}
+	return rv
+}
+
+func ratio(num, denom *big.Int) float64 {
+	f, _ := new(big.Rat).SetFrac(num, denom).Float64()
+	return f
+}
+
+// binomialCache memoizes binomial coefficients, which are needed many times
+// over with the same arguments.
+type binomialCache map[[2]int]*big.Int
+
+// get returns C(n, k), which is zero when k is out of the range [0, n].
+func (b binomialCache) get(n, k int) *big.Int {
+	if n < 0 || k < 0 || k > n {
+		return new(big.Int)
+	}
+	key := [2]int{n, k}
+	if v, ok := b[key]; ok {
+		return v
+	}
+	v := new(big.Int).Binomial(int64(n), int64(k))
+	b[key] = v
+	return v
+}
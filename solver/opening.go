@@ -0,0 +1,99 @@
+package solver
+
+import "fmt"
+
+/* Opening moves.
+ *
+ * The first probe is made knowing nothing but the size of the board, the
+ * number of mines, and what the ruleset promises about that probe. A lone
+ * number on an otherwise unknown board decides nothing, so the best first
+ * probe is the one most likely to be a zero, which opens up an area instead.
+ * Cells with fewer neighbors are more likely to be zeros, which is why the
+ * corners are usually best. When the ruleset promises a zero anyway, every
+ * cell opens an area and the center, with the most neighbors, opens the most.
+ */
+
+// A FirstClick is what a ruleset promises about the first probe of a game.
+type FirstClick string
+
+const (
+	// The first probe is like any other, and may hit a mine.
+	FirstClickAny FirstClick = "any"
+	// The first probe never hits a mine.
+	FirstClickSafe FirstClick = "safe"
+	// The first probe never touches a mine, so it is always a zero.
+	FirstClickZero FirstClick = "zero"
+)
+
+// An Opening is where to make the first probe of a game.
+type Opening string
+
+const (
+	// Whichever of the other openings is most likely to be a zero.
+	OpeningAuto   Opening = "auto"
+	OpeningCorner Opening = "corner"
+	OpeningEdge   Opening = "edge"
+	OpeningCenter Opening = "center"
+)
+
+// OpeningCell returns the cell to probe first on a board of the given size and
+// mine count, under a ruleset promising first about the first probe. It
+// returns an error if first or opening isn't one of the known values.
+func OpeningCell(width, height, minecount int, first FirstClick, opening Opening) ([2]int, error) {
+	switch first {
+	case FirstClickAny, FirstClickSafe, FirstClickZero:
+	default:
+		return [2]int{}, fmt.Errorf("unknown first click rule %q", first)
+	}
+	cells := map[Opening][2]int{
+		OpeningCorner: {0, 0},
+		OpeningEdge:   {width / 2, 0},
+		OpeningCenter: {width / 2, height / 2},
+	}
+	if opening != OpeningAuto {
+		xy, ok := cells[opening]
+		if !ok {
+			return [2]int{}, fmt.Errorf("unknown opening %q", opening)
+		}
+		return xy, nil
+	}
+	// when the chances are the same, prefer the cell which opens the most
+	best, bestChance := cells[OpeningCenter], -1.0
+	for _, o := range []Opening{OpeningCenter, OpeningEdge, OpeningCorner} {
+		chance := ZeroChance(width, height, minecount, first, cells[o])
+		if chance-bestChance > epsilon {
+			best, bestChance = cells[o], chance
+		}
+	}
+	return best, nil
+}
+
+// ZeroChance returns the chance that a first probe at xy is safe and touches no
+// mines, with mines spread at random over the cells the ruleset allows. When
+// the mine count isn't known, every cell is treated as a zero.
+func ZeroChance(width, height, minecount int, first FirstClick, xy [2]int) float64 {
+	if first == FirstClickZero || minecount <= 0 {
+		return 1.0
+	}
+	neighbors := 0
+	for dy := -1; dy <= 1; dy++ {
+		for dx := -1; dx <= 1; dx++ {
+			x, y := xy[0]+dx, xy[1]+dy
+			if (dx == 0 && dy == 0) || x < 0 || x >= width || y < 0 || y >= height {
+				continue
+			}
+			neighbors += 1
+		}
+	}
+	cells := width * height
+	if minecount >= cells {
+		return 0.0
+	}
+	binomials := binomialCache{}
+	// the mines must all be outside the cell and its neighbors
+	zeros := binomials.get(cells-1-neighbors, minecount)
+	if first == FirstClickSafe {
+		return ratio(zeros, binomials.get(cells-1, minecount))
+	}
+	return ratio(zeros, binomials.get(cells, minecount))
+}
@@ -0,0 +1,58 @@
+package solver
+
+import (
+	"math"
+	"testing"
+)
+
+func TestZeroChance(t *testing.T) {
+	// 3x3 with one mine: the corner is a zero unless the mine is in one of
+	// the three cells around it
+	cases := []struct {
+		first    FirstClick
+		xy       [2]int
+		expected float64
+	}{
+		{FirstClickAny, [2]int{0, 0}, 5.0 / 9},
+		{FirstClickSafe, [2]int{0, 0}, 5.0 / 8},
+		{FirstClickSafe, [2]int{1, 1}, 0.0},
+		{FirstClickSafe, [2]int{1, 0}, 3.0 / 8},
+		{FirstClickZero, [2]int{1, 1}, 1.0},
+	}
+	for _, c := range cases {
+		chance := ZeroChance(3, 3, 1, c.first, c.xy)
+		if math.Abs(chance-c.expected) > epsilon {
+			t.Errorf("%s at %v: chance %v, expected %v", c.first, c.xy, chance, c.expected)
+		}
+	}
+}
+
+func TestOpeningCell(t *testing.T) {
+	cases := []struct {
+		first    FirstClick
+		opening  Opening
+		expected [2]int
+	}{
+		{FirstClickSafe, OpeningAuto, [2]int{0, 0}},
+		{FirstClickAny, OpeningAuto, [2]int{0, 0}},
+		{FirstClickZero, OpeningAuto, [2]int{15, 8}},
+		{FirstClickSafe, OpeningEdge, [2]int{15, 0}},
+		{FirstClickSafe, OpeningCenter, [2]int{15, 8}},
+		{FirstClickZero, OpeningCorner, [2]int{0, 0}},
+	}
+	for _, c := range cases {
+		xy, err := OpeningCell(30, 16, 99, c.first, c.opening)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if xy != c.expected {
+			t.Errorf("%s %s: opened at %v, expected %v", c.first, c.opening, xy, c.expected)
+		}
+	}
+	if _, err := OpeningCell(30, 16, 99, FirstClickSafe, "middle"); err == nil {
+		t.Errorf("expected an error for an unknown opening")
+	}
+	if _, err := OpeningCell(30, 16, 99, "lucky", OpeningAuto); err == nil {
+		t.Errorf("expected an error for an unknown first click rule")
+	}
+}
@@ -0,0 +1,358 @@
+package solver
+
+import "sort"
+
+/* Deterministic pattern rules.
+ *
+ * Most moves in a game don't need a search at all: a witness which already
+ * sees all its mines makes its other neighbors safe, two witnesses sharing
+ * most of their neighbors pin down the cells they don't share, and so on.
+ * ApplyRules runs these cheap deductions until none of them fire, and
+ * reports every cell it could decide along with the rule and witnesses that
+ * decided it.
+ */
+
+// A Rule names the method by which a cell was decided.
+type Rule string
+
+const (
+	// A witness sees exactly as many unknown cells as it needs mines, or
+	// already sees all of its mines.
+	RuleSaturation Rule = "saturation"
+	// The unknown neighbors of one witness are a subset of another's, so
+	// the cells only the larger one sees hold the difference of the two.
+	RuleSubset Rule = "subset"
+	// Two witnesses share some unknown neighbors, and bounding the mines in
+	// the shared cells decides the cells only one of them sees.
+	RuleOverlap Rule = "overlap"
+	// Two orthogonally adjacent witnesses needing one mine each.
+	RuleOneOne Rule = "1-1"
+	// Two orthogonally adjacent witnesses needing one and two mines.
+	RuleOneTwo Rule = "1-2"
+	// Three witnesses in a line needing one, two and one mines.
+	RuleOneTwoOne Rule = "1-2-1"
+	// A row of the reduced witness matrix can only be satisfied one way
+	// (see SolveLinear).
+	RuleLinear Rule = "linear"
+)
+
+// A Deduction is an unprobed cell whose contents are known for certain. The
+// Witnesses of its Justification are the ones which justify the deduction;
+// deductions made earlier may have been needed as well.
+type Deduction struct {
+	Cell [2]int `json:"cell"`
+	Mine bool   `json:"mine"`
+	Justification
+}
+
+// newDeduction returns the Deduction of a cell by a deterministic rule.
+func newDeduction(xy [2]int, mine bool, rule Rule, witnesses [][2]int) Deduction {
+	prob := 0.0
+	if mine {
+		prob = 1.0
+	}
+	return Deduction{
+		Cell: xy,
+		Mine: mine,
+		Justification: Justification{
+			Rule:        rule,
+			Witnesses:   witnesses,
+			Probability: prob,
+		},
+	}
+}
+
+// ApplyRules repeatedly applies the pattern rules to the minefield until no
+// more cells can be decided, and returns every Deduction in the order it was
+// made. The minefield is not modified. Flags are not trusted, so a flagged
+// cell may be deduced to be a mine (or safe) like any other.
+func ApplyRules(mf *Minefield) []Deduction {
+	r := ruleEngine{
+		mf:        mf,
+		witnesses: GetWitnesses(mf),
+		known:     map[[2]int]bool{},
+	}
+	r.pairs = witnessPairs(BuildPrimeWitnessMap(frontierCells(mf)))
+	for {
+		progress := false
+		for _, apply := range []func() bool{r.saturation, r.oneTwoOne, r.pairReduction} {
+			if apply() {
+				progress = true
+				break
+			}
+		}
+		if !progress {
+			break
+		}
+	}
+	return r.deductions
+}
+
+type ruleEngine struct {
+	mf         *Minefield
+	witnesses  []*Cell
+	pairs      [][2]*Cell
+	known      map[[2]int]bool
+	deductions []Deduction
+}
+
+// unknown returns the neighbors of witness which are neither probed nor
+// already deduced, sorted by (Y, X), along with the number of mines the
+// witness still needs among them.
+func (r *ruleEngine) unknown(witness *Cell) ([]*Cell, int) {
+	cells := []*Cell{}
+	remaining := witness.MineTouch
+	for _, neighbor := range witness.Neighbors {
+		if neighbor == nil || neighbor.Probed {
+			continue
+		}
+		mine, known := r.known[[2]int{neighbor.X, neighbor.Y}]
+		if !known {
+			cells = append(cells, neighbor)
+		} else if mine {
+			remaining -= 1
+		}
+	}
+	sortCells(cells)
+	return cells, remaining
+}
+
+// deduce records that each of cells is (or isn't) a mine. It returns true if
+// any of them wasn't already known.
+func (r *ruleEngine) deduce(cells []*Cell, mine bool, rule Rule, witnesses ...*Cell) bool {
+	progress := false
+	for _, cell := range cells {
+		xy := [2]int{cell.X, cell.Y}
+		if _, ok := r.known[xy]; ok {
+			continue
+		}
+		r.known[xy] = mine
+		r.deductions = append(r.deductions, newDeduction(xy, mine, rule, cellCoords(witnesses)))
+		progress = true
+	}
+	return progress
+}
+
+func (r *ruleEngine) saturation() bool {
+	progress := false
+	for _, witness := range r.witnesses {
+		cells, remaining := r.unknown(witness)
+		if len(cells) == 0 {
+			continue
+		}
+		if remaining == 0 {
+			progress = r.deduce(cells, false, RuleSaturation, witness) || progress
+		} else if remaining == len(cells) {
+			progress = r.deduce(cells, true, RuleSaturation, witness) || progress
+		}
+	}
+	return progress
+}
+
+// oneTwoOne looks for a witness needing two mines between two witnesses in
+// a line which each need one, all three facing the same row of three (or
+// fewer) unknown cells. The cells facing the 1s are mines, the one facing the
+// 2 is safe, as are any the 1s see beyond the ends of the row.
+func (r *ruleEngine) oneTwoOne() bool {
+	progress := false
+	for _, b := range r.witnesses {
+		bCells, bRemaining := r.unknown(b)
+		if bRemaining != 2 || len(bCells) != 3 {
+			continue
+		}
+		for _, d := range [][2]int{{1, 0}, {0, 1}} {
+			a := r.cellAt(b.X-d[0], b.Y-d[1])
+			c := r.cellAt(b.X+d[0], b.Y+d[1])
+			if a == nil || c == nil || a.MineTouch <= 0 || c.MineTouch <= 0 {
+				continue
+			}
+			aCells, aRemaining := r.unknown(a)
+			cCells, cRemaining := r.unknown(c)
+			if aRemaining != 1 || cRemaining != 1 {
+				continue
+			}
+			for _, side := range []int{1, -1} {
+				// line returns the cell k steps along the row facing b
+				line := func(k int) [2]int {
+					return [2]int{b.X + k*d[0] + side*d[1], b.Y + k*d[1] + side*d[0]}
+				}
+				if !sameCoords(bCells, line(-1), line(0), line(1)) {
+					continue
+				}
+				if !withinCoords(aCells, line(-2), line(-1), line(0)) {
+					continue
+				}
+				if !withinCoords(cCells, line(0), line(1), line(2)) {
+					continue
+				}
+				mines := []*Cell{r.cellAt(line(-1)[0], line(-1)[1]), r.cellAt(line(1)[0], line(1)[1])}
+				safe := []*Cell{r.cellAt(line(0)[0], line(0)[1])}
+				for _, cell := range append(aCells, cCells...) {
+					xy := [2]int{cell.X, cell.Y}
+					if xy == line(-2) || xy == line(2) {
+						safe = append(safe, cell)
+					}
+				}
+				progress = r.deduce(mines, true, RuleOneTwoOne, a, b, c) || progress
+				progress = r.deduce(safe, false, RuleOneTwoOne, a, b, c) || progress
+			}
+		}
+	}
+	return progress
+}
+
+// pairReduction compares every two witnesses which share an unknown cell.
+// The number of mines in the shared cells is bounded by what each witness
+// needs, which in turn bounds the mines in the cells only one of them sees.
+func (r *ruleEngine) pairReduction() bool {
+	progress := false
+	for _, pair := range r.pairs {
+		for _, order := range [][2]*Cell{{pair[0], pair[1]}, {pair[1], pair[0]}} {
+			a, b := order[0], order[1]
+			aCells, aRemaining := r.unknown(a)
+			bCells, bRemaining := r.unknown(b)
+			shared := map[[2]int]bool{}
+			for _, cell := range aCells {
+				shared[[2]int{cell.X, cell.Y}] = true
+			}
+			onlyB := []*Cell{}
+			sharedCount := 0
+			for _, cell := range bCells {
+				if shared[[2]int{cell.X, cell.Y}] {
+					sharedCount += 1
+				} else {
+					onlyB = append(onlyB, cell)
+				}
+			}
+			onlyA := len(aCells) - sharedCount
+			if sharedCount == 0 || len(onlyB) == 0 {
+				continue
+			}
+			minShared := maxInt(0, aRemaining-onlyA, bRemaining-len(onlyB))
+			maxShared := minInt(sharedCount, aRemaining, bRemaining)
+			if minShared > maxShared {
+				// the witnesses contradict each other; leave that to
+				// Analyze to report
+				continue
+			}
+			rule := RuleOverlap
+			if onlyA == 0 {
+				rule = RuleSubset
+			}
+			if abs(a.X-b.X)+abs(a.Y-b.Y) == 1 {
+				if aRemaining == 1 && bRemaining == 1 {
+					rule = RuleOneOne
+				} else if aRemaining == 1 && bRemaining == 2 {
+					rule = RuleOneTwo
+				}
+			}
+			// the cells only b sees hold between bRemaining-maxShared and
+			// bRemaining-minShared mines
+			if bRemaining-minShared == 0 {
+				progress = r.deduce(onlyB, false, rule, a, b) || progress
+			} else if bRemaining-maxShared == len(onlyB) {
+				progress = r.deduce(onlyB, true, rule, a, b) || progress
+			}
+		}
+	}
+	return progress
+}
+
+func (r *ruleEngine) cellAt(x, y int) *Cell {
+	if x < 0 || x >= r.mf.Width || y < 0 || y >= r.mf.Height {
+		return nil
+	}
+	return r.mf.Cells[x+y*r.mf.Width]
+}
+
+// witnessPairs lists every pair of distinct witnesses which share a primed
+// cell, given the map built by BuildPrimeWitnessMap.
+func witnessPairs(primeWitnesses map[[2]int][]*Cell) [][2]*Cell {
+	seen := map[[2][2]int]bool{}
+	pairs := [][2]*Cell{}
+	// iterate the primed cells in a fixed order so deductions are
+	// reproducible
+	primed := make([][2]int, 0, len(primeWitnesses))
+	for xy := range primeWitnesses {
+		primed = append(primed, xy)
+	}
+	sort.Slice(primed, func(i, j int) bool {
+		if primed[i][1] != primed[j][1] {
+			return primed[i][1] < primed[j][1]
+		}
+		return primed[i][0] < primed[j][0]
+	})
+	for _, xy := range primed {
+		witnesses := append([]*Cell{}, primeWitnesses[xy]...)
+		sortCells(witnesses)
+		for i := range witnesses {
+			for j := i + 1; j < len(witnesses); j++ {
+				key := [2][2]int{{witnesses[i].X, witnesses[i].Y}, {witnesses[j].X, witnesses[j].Y}}
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+				pairs = append(pairs, [2]*Cell{witnesses[i], witnesses[j]})
+			}
+		}
+	}
+	return pairs
+}
+
+// sortCells sorts cells by their (Y, X) coordinates, the same order as the
+// Cells of a Minefield.
+func sortCells(cells []*Cell) {
+	sort.Slice(cells, func(i, j int) bool {
+		if cells[i].Y != cells[j].Y {
+			return cells[i].Y < cells[j].Y
+		}
+		return cells[i].X < cells[j].X
+	})
+}
+
+// sameCoords reports whether cells are exactly the given coordinates.
+func sameCoords(cells []*Cell, coords ...[2]int) bool {
+	return len(cells) == len(coords) && withinCoords(cells, coords...)
+}
+
+// withinCoords reports whether every one of cells is at one of coords.
+func withinCoords(cells []*Cell, coords ...[2]int) bool {
+	for _, cell := range cells {
+		found := false
+		for _, xy := range coords {
+			if xy == [2]int{cell.X, cell.Y} {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func minInt(first int, rest ...int) int {
+	for _, v := range rest {
+		if v < first {
+			first = v
+		}
+	}
+	return first
+}
+
+func maxInt(first int, rest ...int) int {
+	for _, v := range rest {
+		if v > first {
+			first = v
+		}
+	}
+	return first
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
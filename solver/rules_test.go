@@ -0,0 +1,133 @@
+package solver
+
+import (
+	"reflect"
+	"testing"
+)
+
+// expectDeductions checks that the deductions decide exactly the expected
+// cells (true for a mine) and that each was decided by the given rule.
+func expectDeductions(t *testing.T, deductions []Deduction, expected map[[2]int]bool, rules map[[2]int]Rule) {
+	t.Helper()
+	found := map[[2]int]Deduction{}
+	for _, d := range deductions {
+		if _, ok := found[d.Cell]; ok {
+			t.Errorf("cell %v was deduced twice", d.Cell)
+		}
+		found[d.Cell] = d
+	}
+	for xy, mine := range expected {
+		d, ok := found[xy]
+		if !ok {
+			t.Errorf("cell %v was not deduced", xy)
+			continue
+		}
+		if d.Mine != mine {
+			t.Errorf("cell %v deduced as mine=%v, expected %v", xy, d.Mine, mine)
+		}
+		if rule, ok := rules[xy]; ok && d.Rule != rule {
+			t.Errorf("cell %v deduced by rule %q, expected %q", xy, d.Rule, rule)
+		}
+	}
+	for xy := range found {
+		if _, ok := expected[xy]; !ok {
+			t.Errorf("unexpected deduction for cell %v", xy)
+		}
+	}
+}
+
+func TestRuleSaturation(t *testing.T) {
+	mf := parseField(t,
+		"??",
+		"3?",
+	)
+	expectDeductions(t, ApplyRules(mf),
+		map[[2]int]bool{{0, 0}: true, {1, 0}: true, {1, 1}: true},
+		map[[2]int]Rule{{0, 0}: RuleSaturation},
+	)
+}
+
+func TestRuleOneOne(t *testing.T) {
+	// Along the wall, the top 1 sees two cells which the lower 1 also sees,
+	// so the other cells the lower 1 sees are safe.
+	mf := parseField(t,
+		"1?",
+		"1?",
+		"??",
+	)
+	expectDeductions(t, ApplyRules(mf),
+		map[[2]int]bool{{0, 2}: false, {1, 2}: false},
+		map[[2]int]Rule{{0, 2}: RuleOneOne, {1, 2}: RuleOneOne},
+	)
+}
+
+func TestRuleOneTwo(t *testing.T) {
+	// The 2 sees one cell more than the 1 next to it, which must hold its
+	// second mine.
+	mf := parseField(t,
+		"121?",
+		"????",
+	)
+	deductions := ApplyRules(mf)
+	if len(deductions) == 0 {
+		t.Fatalf("no deductions made")
+	}
+	expected := newDeduction([2]int{2, 1}, true, RuleOneTwo, [][2]int{{0, 0}, {1, 0}})
+	if !reflect.DeepEqual(deductions[0], expected) {
+		t.Errorf("expected first deduction %+v, found %+v", expected, deductions[0])
+	}
+}
+
+func TestRuleOneTwoOne(t *testing.T) {
+	mf := parseField(t,
+		"?????",
+		"11211",
+		".....",
+	)
+	expectDeductions(t, ApplyRules(mf),
+		map[[2]int]bool{
+			{0, 0}: false,
+			{1, 0}: true,
+			{2, 0}: false,
+			{3, 0}: true,
+			{4, 0}: false,
+		},
+		map[[2]int]Rule{
+			{0, 0}: RuleOneTwoOne,
+			{1, 0}: RuleOneTwoOne,
+			{2, 0}: RuleOneTwoOne,
+			{3, 0}: RuleOneTwoOne,
+			{4, 0}: RuleOneTwoOne,
+		},
+	)
+}
+
+func TestRuleSubset(t *testing.T) {
+	// The corner 1 only sees cells which the 1 diagonal to it also sees,
+	// so every other cell around the middle 1 is safe.
+	mf := parseField(t,
+		"1??",
+		"?1?",
+		"???",
+	)
+	safe := map[[2]int]bool{}
+	rules := map[[2]int]Rule{}
+	for _, xy := range [][2]int{{2, 0}, {2, 1}, {0, 2}, {1, 2}, {2, 2}} {
+		safe[xy] = false
+		rules[xy] = RuleSubset
+	}
+	expectDeductions(t, ApplyRules(mf), safe, rules)
+}
+
+func TestApplyRulesDoesNotModify(t *testing.T) {
+	mf := parseField(t,
+		"???",
+		"121",
+	)
+	ApplyRules(mf)
+	for _, cell := range mf.Cells {
+		if cell.MineProb != -1.0 || cell.Flagged {
+			t.Errorf("cell (%d, %d) was modified", cell.X, cell.Y)
+		}
+	}
+}
@@ -28,6 +28,9 @@ type Cell struct {
 type Minefield struct {
 	Height int
 	Width  int
+	// Minecount is the total number of mines on the board, flagged or not.
+	// A Minecount of 0 means the number of mines is unknown.
+	Minecount int
 	// Cells will be a correctly-sorted slice of pointers to
 	// limited-information Cells.
 	Cells []*Cell
@@ -80,9 +83,10 @@ func NewMinefield(mf defusedivision.Minefield) (*Minefield, error) {
 		Cells = append(Cells, nc)
 	}
 	m := Minefield{
-		Height: mf.Height,
-		Width:  mf.Width,
-		Cells:  Cells,
+		Height:    mf.Height,
+		Width:     mf.Width,
+		Minecount: mf.Minecount,
+		Cells:     Cells,
 	}
 	// Build each Cell's record of its neighbors
 	// (This is the "second sweep" for NewCell)
@@ -121,6 +125,27 @@ func NewMinefield(mf defusedivision.Minefield) (*Minefield, error) {
 	return &m, nil
 }
 
+// Copy returns a copy of mf whose cells are copies of its cells, neighbors
+// included, so that the copy can be changed without changing mf.
+func (mf *Minefield) Copy() *Minefield {
+	cp := *mf
+	cp.Cells = make([]*Cell, len(mf.Cells))
+	copies := map[*Cell]*Cell{}
+	for idx, c := range mf.Cells {
+		cell := *c
+		cp.Cells[idx] = &cell
+		copies[c] = &cell
+	}
+	for _, cell := range cp.Cells {
+		neighbors := map[string]*Cell{}
+		for direction, neighbor := range cell.Neighbors {
+			neighbors[direction] = copies[neighbor]
+		}
+		cell.Neighbors = neighbors
+	}
+	return &cp
+}
+
 func NewCell(ddc *defusedivision.Cell) (*Cell, error) {
 	var minetouch int
 	if !ddc.Probed {
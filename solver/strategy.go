@@ -0,0 +1,326 @@
+package solver
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+/* Strategies.
+ *
+ * A Strategy looks at a board and decides what to do next, as an ordered list
+ * of Actions. Cells which are certainly mines are flagged, cells which are
+ * certainly safe are probed (or chorded), and when nothing is certain a
+ * Strategy makes a single guess, which is always its last action. Whatever
+ * plays the game (a bot against a server, the benchmark, a test) performs the
+ * actions in order, stopping if a probe explodes, and then asks again with the
+ * new board.
+ */
+
+// An ActionKind is what to do with a cell.
+type ActionKind string
+
+const (
+	ActionProbe ActionKind = "probe"
+	ActionFlag  ActionKind = "flag"
+	// Probe every unflagged neighbor of a probed cell, which is only done
+	// when the cell already has as many flags around it as its number.
+	ActionChord ActionKind = "chord"
+)
+
+const (
+	// The cell's probability was estimated by averaging over its witnesses
+	// (see PrimedFieldProbability).
+	RuleHeuristic Rule = "heuristic"
+	// Marking the cell as a mine leaves no way to satisfy its witnesses (see
+	// SatisfyWitnesses).
+	RuleHypothetical Rule = "hypothetical"
+)
+
+// An Action is one step a Strategy wants taken, with the Justification for
+// taking it. A probe whose Probability is above zero is a guess.
+type Action struct {
+	Kind ActionKind `json:"kind"`
+	Cell [2]int     `json:"cell"`
+	Justification
+}
+
+func (a Action) String() string {
+	return fmt.Sprintf("%s (%d, %d) by %v", a.Kind, a.Cell[0], a.Cell[1], a.Justification)
+}
+
+// Guess reports whether the action is a probe of a cell which isn't known to
+// be safe.
+func (a Action) Guess() bool {
+	return a.Kind == ActionProbe && a.Probability > 0.0
+}
+
+// A Strategy decides the next actions to take on a board. NextActions may set
+// the MineProb of the cells of mf, so that the board can be rendered with the
+// probabilities the strategy used, but doesn't otherwise modify it.
+type Strategy interface {
+	Name() string
+	NextActions(mf *Minefield) ([]Action, error)
+}
+
+// Strategies are the strategies which can be chosen by name, e.g. from the
+// command line.
+var Strategies = map[string]Strategy{}
+
+func init() {
+	for _, s := range []Strategy{HeuristicStrategy{}, ExactStrategy{}, InfoGainStrategy{}} {
+		Strategies[s.Name()] = s
+	}
+}
+
+// StrategyNames returns the names of every entry of Strategies, sorted.
+func StrategyNames() []string {
+	names := []string{}
+	for name := range Strategies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// HeuristicStrategy is the original strategy of the bot. It estimates the
+// probability of each primed cell by averaging over its witnesses, flags the
+// cells which are certainly mines, and probes the cell least likely to be
+// one. When that cell might be a mine, each component of the frontier is
+// searched for a cell which cannot be a mine, and failing that for the cell
+// with the most ways to satisfy its witnesses.
+//
+// Unlike the original bot, it skips that search in components of more than
+// maxHypotheticalCells cells, so it plays slightly differently.
+type HeuristicStrategy struct{}
+
+func (HeuristicStrategy) Name() string {
+	return "heuristic"
+}
+
+func (HeuristicStrategy) NextActions(mf *Minefield) ([]Action, error) {
+	PrimedFieldProbability(mf)
+	actions := []Action{}
+	for _, cell := range UnflaggedMines(mf) {
+		actions = append(actions, Action{
+			Kind:          ActionFlag,
+			Cell:          [2]int{cell.X, cell.Y},
+			Justification: Justification{Rule: RuleHeuristic, Probability: 1.0},
+		})
+	}
+	safest := GetSafestCell(mf)
+	if safest == nil {
+		probe, err := firstUnmarked(mf)
+		if err != nil {
+			return nil, err
+		}
+		return append(actions, probe), nil
+	}
+	probe := Action{
+		Kind:          ActionProbe,
+		Cell:          [2]int{safest.X, safest.Y},
+		Justification: Justification{Rule: RuleHeuristic, Probability: safest.MineProb},
+	}
+	if safest.MineProb > 0.0 {
+		if hypothetical, ok := hypotheticalProbe(mf); ok {
+			probe = hypothetical
+		}
+	}
+	return append(actions, probe), nil
+}
+
+// maxHypotheticalCells is the size of the largest component which
+// hypotheticalProbe searches. SatisfyWitnesses tries the cells of a component
+// in every order, so the time it takes grows factorially with its size, and
+// without a limit a single move on a 9x9 board can take over a minute.
+const maxHypotheticalCells = 8
+
+// hypotheticalProbe tries marking each primed cell as a mine, one component
+// at a time, and returns a probe of the first cell for which that leaves no
+// way to satisfy the witnesses. Failing that, it probes the cell which took
+// the most scenarios to satisfy the witnesses with, if there is one.
+func hypotheticalProbe(mf *Minefield) (Action, bool) {
+	likelyhood := map[uint]*Cell{}
+	bestScenario := uint(0)
+	for _, component := range SplitComponents(GetWitnesses(mf), GetPrimedCells(mf)) {
+		witnesses := component.Witnesses
+		primedCells := GetValidPrimedCells(witnesses, component.Cells)
+		if len(primedCells) > maxHypotheticalCells {
+			continue
+		}
+		// once a hypothetical mine is part of a scenario satisfying every
+		// witness, trying it again would only find another success
+		validHypotheticalMine := map[[2]int]bool{}
+		for _, hypothetical := range primedCells {
+			coordinates := [2]int{hypothetical.X, hypothetical.Y}
+			if validHypotheticalMine[coordinates] {
+				continue
+			}
+			tempProb := hypothetical.MineProb
+			hypothetical.MineProb = 1.0
+			flags, scenarios, success, _ := SatisfyWitnesses(witnesses, primedCells)
+			hypothetical.MineProb = tempProb
+			if !success {
+				return Action{
+					Kind: ActionProbe,
+					Cell: coordinates,
+					Justification: Justification{
+						Rule:      RuleHypothetical,
+						Witnesses: cellCoords(witnesses),
+					},
+				}, true
+			}
+			for coordinates := range flags {
+				validHypotheticalMine[coordinates] = true
+			}
+			likelyhood[scenarios] = hypothetical
+			if scenarios > bestScenario {
+				bestScenario = scenarios
+			}
+		}
+	}
+	best, ok := likelyhood[bestScenario]
+	if !ok {
+		return Action{}, false
+	}
+	return Action{
+		Kind:          ActionProbe,
+		Cell:          [2]int{best.X, best.Y},
+		Justification: Justification{Rule: RuleHeuristic, Probability: best.MineProb},
+	}, true
+}
+
+// ExactStrategy flags and probes every cell the pattern rules can decide,
+// then every cell the linear solver can decide, and only then calculates
+// exact probabilities (see Analyze). Safe cells around a witness whose mines
+// are all flagged are opened with a chord. With nothing certain it guesses the
+// cell least likely to be a mine. If the witnesses contradict each other it
+// falls back to HeuristicStrategy.
+type ExactStrategy struct{}
+
+func (ExactStrategy) Name() string {
+	return "exact"
+}
+
+func (ExactStrategy) NextActions(mf *Minefield) ([]Action, error) {
+	return exactActions(mf, safestProbe)
+}
+
+// InfoGainStrategy decides cells the same way as ExactStrategy, but when it
+// has to guess it weighs what each guess could reveal as well as its risk
+// (see informativeProbe).
+type InfoGainStrategy struct{}
+
+func (InfoGainStrategy) Name() string {
+	return "infogain"
+}
+
+func (InfoGainStrategy) NextActions(mf *Minefield) ([]Action, error) {
+	return exactActions(mf, informativeProbe)
+}
+
+// exactActions are the actions of ExactStrategy, with guess choosing the
+// probe when no cell is certainly safe. The MineProb of mf has been set from
+// the analysis when guess is called.
+func exactActions(mf *Minefield, guess func(*Minefield, Analysis) (Action, error)) ([]Action, error) {
+	for _, deduce := range []func(*Minefield) []Deduction{ApplyRules, SolveLinear} {
+		deductions := deduce(mf)
+		if flags, probes := deducedActions(mf, deductions); len(probes) > 0 {
+			applyDeductions(mf, deductions)
+			return chordActions(mf, flags, probes), nil
+		}
+	}
+	analysis, err := Analyze(mf)
+	if err != nil {
+		return nil, err
+	}
+	if len(analysis.Contradictions) > 0 {
+		return HeuristicStrategy{}.NextActions(mf)
+	}
+	analysis.Apply(mf)
+	flags, probes := deducedActions(mf, analysis.Deductions())
+	if len(probes) > 0 {
+		return chordActions(mf, flags, probes), nil
+	}
+	probe, err := guess(mf, analysis)
+	if err != nil {
+		return nil, err
+	}
+	return append(flags, probe), nil
+}
+
+// deducedActions returns a flag for every unflagged mine among the
+// deductions, and a probe for every safe cell. A safe cell which is flagged
+// is unflagged (flagged again) first, since the game won't probe a flagged
+// cell.
+func deducedActions(mf *Minefield, deductions []Deduction) ([]Action, []Action) {
+	flags, probes := []Action{}, []Action{}
+	for _, d := range deductions {
+		cell := mf.Cells[d.Cell[0]+d.Cell[1]*mf.Width]
+		if d.Mine && !cell.Flagged {
+			flags = append(flags, Action{Kind: ActionFlag, Cell: d.Cell, Justification: d.Justification})
+		} else if !d.Mine && !cell.Probed {
+			if cell.Flagged {
+				flags = append(flags, Action{Kind: ActionFlag, Cell: d.Cell, Justification: d.Justification})
+			}
+			probes = append(probes, Action{Kind: ActionProbe, Cell: d.Cell, Justification: d.Justification})
+		}
+	}
+	return flags, probes
+}
+
+// applyDeductions sets the MineProb of the probed cells of mf to 0, and of
+// each deduced cell to 0 or 1, like Analysis.Apply does for an analysis.
+func applyDeductions(mf *Minefield, deductions []Deduction) {
+	for _, cell := range mf.Cells {
+		if cell.Probed {
+			cell.MineProb = 0.0
+		}
+	}
+	for _, d := range deductions {
+		cell := mf.Cells[d.Cell[0]+d.Cell[1]*mf.Width]
+		if d.Mine {
+			cell.MineProb = 1.0
+		} else {
+			cell.MineProb = 0.0
+		}
+	}
+}
+
+// safestProbe probes the unmarked cell with the lowest MineProb, or the
+// first unmarked cell if none has a MineProb.
+func safestProbe(mf *Minefield, analysis Analysis) (Action, error) {
+	safest := GetSafestCell(mf)
+	if safest == nil {
+		return firstUnmarked(mf)
+	}
+	xy := [2]int{safest.X, safest.Y}
+	return Action{Kind: ActionProbe, Cell: xy, Justification: analysis.Justifications[xy]}, nil
+}
+
+// firstUnmarked probes the first cell which is neither probed nor flagged,
+// for when nothing is known about any of them. Its probability is the density
+// of the mines left, or 1.0 when the mine count isn't known, so that the probe
+// still counts as a guess.
+func firstUnmarked(mf *Minefield) (Action, error) {
+	unmarked := GetUnmarkedCells(mf)
+	if len(unmarked) == 0 {
+		return Action{}, errors.New("no cell left to probe")
+	}
+	cell := unmarked[0]
+	prob := 1.0
+	if mf.Minecount > 0 {
+		left := mf.Minecount
+		for _, c := range mf.Cells {
+			if c.Flagged {
+				left -= 1
+			}
+		}
+		prob = float64(left) / float64(len(unmarked))
+	}
+	return Action{
+		Kind:          ActionProbe,
+		Cell:          [2]int{cell.X, cell.Y},
+		Justification: Justification{Rule: RuleHeuristic, Probability: prob},
+	}, nil
+}
@@ -0,0 +1,157 @@
+package solver
+
+import (
+	"math"
+	"testing"
+)
+
+// checkActionOrder checks that flags come before probes, and that a guess is
+// only ever the last action.
+func checkActionOrder(t *testing.T, name string, actions []Action) {
+	t.Helper()
+	if len(actions) == 0 {
+		t.Fatalf("%s: no actions", name)
+	}
+	probed := false
+	for idx, action := range actions {
+		switch action.Kind {
+		case ActionFlag:
+			if probed {
+				t.Errorf("%s: flag %v after a probe", name, action.Cell)
+			}
+		case ActionProbe:
+			probed = true
+			if action.Guess() && idx != len(actions)-1 {
+				t.Errorf("%s: guess %v is not the last action", name, action.Cell)
+			}
+		}
+	}
+	if !probed {
+		t.Errorf("%s: no probe among %v", name, actions)
+	}
+}
+
+func TestStrategiesProbeSafeCells(t *testing.T) {
+	for _, name := range StrategyNames() {
+		mf := parseField(t,
+			"1?",
+			"1?",
+			"??",
+		)
+		actions, err := Strategies[name].NextActions(mf)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		checkActionOrder(t, name, actions)
+		for _, action := range actions {
+			if action.Guess() {
+				t.Errorf("%s: guessed %v with safe cells left", name, action.Cell)
+			}
+		}
+	}
+}
+
+func TestExactStrategyAllSafe(t *testing.T) {
+	mf := parseField(t,
+		"1?",
+		"1?",
+		"??",
+	)
+	actions, err := ExactStrategy{}.NextActions(mf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	probes := map[[2]int]bool{}
+	for _, action := range actions {
+		if action.Kind == ActionProbe {
+			probes[action.Cell] = true
+		}
+	}
+	if !probes[[2]int{0, 2}] || !probes[[2]int{1, 2}] || len(probes) != 2 {
+		t.Errorf("expected probes of (0, 2) and (1, 2), found %v", actions)
+	}
+	// the board can be drawn with what the rules decided
+	for _, cell := range mf.Cells {
+		xy := [2]int{cell.X, cell.Y}
+		if (cell.Probed || probes[xy]) && cell.MineProb != 0.0 {
+			t.Errorf("(%d, %d) has MineProb %v, expected 0", cell.X, cell.Y, cell.MineProb)
+		}
+	}
+}
+
+func TestStrategiesGuess(t *testing.T) {
+	for _, name := range StrategyNames() {
+		// every unknown cell is a mine with probability 1/3
+		mf := parseField(t,
+			"??",
+			"1?",
+		)
+		actions, err := Strategies[name].NextActions(mf)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		checkActionOrder(t, name, actions)
+		guess := actions[len(actions)-1]
+		if !guess.Guess() {
+			t.Errorf("%s: expected a guess, found %v", name, guess)
+		}
+		if math.Abs(guess.Probability-1.0/3) > epsilon {
+			t.Errorf("%s: guessed with probability %v, expected 1/3", name, guess.Probability)
+		}
+	}
+}
+
+func TestExactStrategyFlagsBeforeGuess(t *testing.T) {
+	// the 3 makes all its neighbors mines, which leaves one mine somewhere
+	// among the four unconstrained cells
+	mf := parseField(t,
+		"????",
+		"3???",
+	)
+	mf.Minecount = 4
+	actions, err := ExactStrategy{}.NextActions(mf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkActionOrder(t, "exact", actions)
+	if len(actions) != 4 {
+		t.Fatalf("expected three flags and a guess, found %v", actions)
+	}
+	guess := actions[3]
+	if !guess.Guess() || guess.Probability != 0.25 {
+		t.Errorf("expected a guess with probability 0.25, found %v", guess)
+	}
+}
+
+func TestDeducedActionsUnflagSafeCells(t *testing.T) {
+	mf := parseField(t,
+		"1F",
+		"1?",
+		"??",
+	)
+	deductions := []Deduction{
+		{Cell: [2]int{1, 0}, Mine: false},
+		{Cell: [2]int{1, 1}, Mine: true},
+	}
+	flags, probes := deducedActions(mf, deductions)
+	if len(flags) != 2 || flags[0].Cell != [2]int{1, 0} || flags[1].Cell != [2]int{1, 1} {
+		t.Errorf("expected the flag on (1, 0) to come off and (1, 1) to be flagged, found %v", flags)
+	}
+	if len(probes) != 1 || probes[0].Cell != [2]int{1, 0} {
+		t.Errorf("expected a probe of (1, 0), found %v", probes)
+	}
+	actions := chordActions(mf, flags, probes)
+	checkActionOrder(t, "exact", actions)
+}
+
+func TestActionString(t *testing.T) {
+	action := Action{
+		Kind:          ActionProbe,
+		Cell:          [2]int{2, 1},
+		Justification: Justification{Rule: RuleHeuristic, Probability: 0.25},
+	}
+	expected := "probe (2, 1) by heuristic (25.0%)"
+	if action.String() != expected {
+		t.Errorf("expected %q, found %q", expected, action.String())
+	}
+}
@@ -0,0 +1,483 @@
+// Package tui shows a game being played in the terminal, redrawing the board
+// in place after every action instead of printing a new one. Cells are
+// coloured by the probability that they hold a mine, the cursor and the next
+// planned action are highlighted, and a panel beside the board explains the
+// next action. The game can be paused and stepped through one action at a
+// time, and a person can take over with actions of their own.
+//
+// Only ANSI escape codes are used, so any terminal which understands them will
+// do.
+package tui
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lelandbatey/minesweeper-solver/defusedivision"
+	"github.com/lelandbatey/minesweeper-solver/runner"
+	"github.com/lelandbatey/minesweeper-solver/solver"
+)
+
+const (
+	home       = "\x1b[H\x1b[2J"
+	hideCursor = "\x1b[?25l"
+	showCursor = "\x1b[?25h"
+	reset      = "\x1b[0m"
+	reverse    = "\x1b[7m"
+	underline  = "\x1b[1;4m"
+)
+
+// DefaultDelay is how long a running game waits between actions.
+const DefaultDelay = 200 * time.Millisecond
+
+// byHand is the rule of the actions taken by a person rather than the
+// strategy.
+const byHand solver.Rule = "by hand"
+
+// A TUI draws a game played by runner.PlayRecorded, which it is the Recorder
+// of. While the TUI is paused the game waits for a key before each action:
+// "s" takes one step, "r" runs and "p" pauses again. "q" calls the quit
+// function given to New, which should stop the game.
+//
+// The TUI is also a runner.Intervener. The cursor is moved with "hjkl" or the
+// arrow keys, and "x" probes the cell under it and "f" flags it, in place of
+// the rest of the strategy's actions.
+type TUI struct {
+	// Delay is how long to wait between actions while running.
+	Delay time.Duration
+
+	out  io.Writer
+	keys chan byte
+	quit func()
+	// done is closed by Close, to stop reading keys
+	done      chan struct{}
+	closeOnce sync.Once
+
+	mu      sync.Mutex
+	screen  screen
+	running bool
+	quitted bool
+	// escape is how far into an arrow key's escape sequence the keys are
+	escape int
+	// intervention are the actions asked for, not yet taken
+	intervention []solver.Action
+}
+
+// New returns a paused TUI drawing to out and reading keys from in. Keys are
+// read until in ends, so in is best left open for as long as the program runs.
+func New(out io.Writer, in io.Reader, strategy string, quit func()) *TUI {
+	t := &TUI{
+		Delay:  DefaultDelay,
+		out:    out,
+		keys:   make(chan byte),
+		quit:   quit,
+		done:   make(chan struct{}),
+		screen: screen{strategy: strategy, cursor: [2]int{-1, -1}},
+	}
+	go t.read(in)
+	fmt.Fprint(out, hideCursor)
+	return t
+}
+
+// Close leaves the terminal as it found it, with the last board drawn. Keys
+// are no longer read once the read in progress returns.
+func (t *TUI) Close() error {
+	t.closeOnce.Do(func() { close(t.done) })
+	_, err := fmt.Fprint(t.out, reset+showCursor+"\n")
+	return err
+}
+
+func (t *TUI) Decided(mf *solver.Minefield, actions []solver.Action) {
+	t.mu.Lock()
+	t.screen.decide(mf, actions)
+	t.mu.Unlock()
+	t.wait()
+}
+
+func (t *TUI) Moved(move runner.Move) {
+	t.mu.Lock()
+	t.screen.move(move)
+	t.mu.Unlock()
+	t.wait()
+}
+
+func (t *TUI) Resynced(player defusedivision.Player) {
+	t.mu.Lock()
+	t.screen.resync(player)
+	t.mu.Unlock()
+	t.draw()
+}
+
+// Intervention returns the actions asked for since it was last called.
+func (t *TUI) Intervention() []solver.Action {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	actions := t.intervention
+	t.intervention = nil
+	return actions
+}
+
+// read sends each byte of in to t.keys, until t is closed.
+func (t *TUI) read(in io.Reader) {
+	buf := make([]byte, 1)
+	for {
+		if _, err := in.Read(buf); err != nil {
+			return
+		}
+		select {
+		case t.keys <- buf[0]:
+		case <-t.done:
+			return
+		}
+	}
+}
+
+// wait draws the screen, then waits until the game may go on: for a step or
+// run key while paused, or for the delay while running.
+func (t *TUI) wait() {
+	for {
+		t.draw()
+		t.mu.Lock()
+		running, quitted, delay := t.running, t.quitted, t.Delay
+		intervened := len(t.intervention) > 0
+		t.mu.Unlock()
+		if quitted || intervened {
+			return
+		}
+		var timeout <-chan time.Time
+		if running {
+			timeout = time.After(delay)
+		}
+		select {
+		case <-timeout:
+			return
+		case key := <-t.keys:
+			if t.press(key) {
+				return
+			}
+		}
+	}
+}
+
+// arrows are the keys moving the cursor, by the offset they move it by. The
+// arrow keys send "\x1b[" followed by a letter.
+var arrows = map[byte][2]int{
+	'h': {-1, 0},
+	'j': {0, 1},
+	'k': {0, -1},
+	'l': {1, 0},
+}
+
+var arrowLetters = map[byte]byte{'A': 'k', 'B': 'j', 'C': 'l', 'D': 'h'}
+
+// press handles key, and reports whether the game should take its next step.
+func (t *TUI) press(key byte) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch {
+	case key == '\x1b':
+		t.escape = 1
+		return false
+	case t.escape == 1 && key == '[':
+		t.escape = 2
+		return false
+	case t.escape == 2 && arrowLetters[key] != 0:
+		key = arrowLetters[key]
+	}
+	t.escape = 0
+	if delta, ok := arrows[key]; ok {
+		t.screen.moveCursor(delta)
+		return false
+	}
+	switch key {
+	case 's', ' ':
+		t.running = false
+		return true
+	case 'r':
+		t.running = true
+		return true
+	case 'p':
+		t.running = false
+	case 'x', 'f':
+		if t.screen.cell(t.screen.cursor) == nil {
+			return false
+		}
+		kind := solver.ActionProbe
+		if key == 'f' {
+			kind = solver.ActionFlag
+		}
+		t.intervention = append(t.intervention, solver.Action{
+			Kind:          kind,
+			Cell:          t.screen.cursor,
+			Justification: solver.Justification{Rule: byHand},
+		})
+		return true
+	case 'q':
+		t.quitted = true
+		if t.quit != nil {
+			t.quit()
+		}
+		return true
+	}
+	return false
+}
+
+func (t *TUI) draw() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	status := "paused: s step, r run, q quit; hjkl move, x probe, f flag"
+	if t.running {
+		status = "running: p pause, q quit; hjkl move, x probe, f flag"
+	}
+	if t.quitted {
+		status = "quitting"
+	}
+	fmt.Fprint(t.out, home+t.screen.render(status))
+}
+
+// A screen is everything drawn by a TUI.
+type screen struct {
+	strategy string
+	// board is the latest board, with the MineProb of each unprobed cell
+	// as of the latest decision
+	board  *solver.Minefield
+	probs  map[[2]int]float64
+	cursor [2]int
+	// planned are the actions of the latest decision not yet taken
+	planned []solver.Action
+	moves   int
+	last    string
+}
+
+func (s *screen) decide(mf *solver.Minefield, actions []solver.Action) {
+	s.probs = map[[2]int]float64{}
+	for _, c := range mf.Cells {
+		s.probs[[2]int{c.X, c.Y}] = c.MineProb
+	}
+	s.board = mf.Copy()
+	for _, c := range s.board.Cells {
+		c.MineProb = s.probs[[2]int{c.X, c.Y}]
+	}
+	s.planned = actions
+	s.skipProbed()
+}
+
+func (s *screen) move(move runner.Move) {
+	action := move.Action
+	s.moves += 1
+	s.last = fmt.Sprintf("%s (%d, %d) answered in %v", action.Kind, action.Cell[0], action.Cell[1], move.Answered.Sub(move.Sent).Round(time.Microsecond))
+	if move.Err != nil {
+		s.last = fmt.Sprintf("%s (%d, %d) failed: %v", action.Kind, action.Cell[0], action.Cell[1], move.Err)
+		return
+	}
+	s.cursor = action.Cell
+	if action.Kind == solver.ActionFlag {
+		if c := s.cell(action.Cell); c != nil && !c.Probed {
+			c.Flagged = !c.Flagged
+		}
+	} else {
+		s.show(move.Player)
+	}
+	for idx, planned := range s.planned {
+		if planned.Kind == action.Kind && planned.Cell == action.Cell {
+			s.planned = s.planned[idx+1:]
+			break
+		}
+		if idx == len(s.planned)-1 {
+			// an action taken by hand replaces the rest of the plan
+			s.planned = nil
+		}
+	}
+	s.skipProbed()
+}
+
+// moveCursor moves the cursor by delta, keeping it on the board.
+func (s *screen) moveCursor(delta [2]int) {
+	if s.board == nil {
+		return
+	}
+	x, y := s.cursor[0]+delta[0], s.cursor[1]+delta[1]
+	if s.cell([2]int{x, y}) == nil {
+		// the cursor stops at the edge, and one yet to be placed
+		// starts in the top left
+		x, y = clamp(x, s.board.Width), clamp(y, s.board.Height)
+	}
+	s.cursor = [2]int{x, y}
+}
+
+func clamp(v, n int) int {
+	if v < 0 {
+		return 0
+	}
+	if v >= n {
+		return n - 1
+	}
+	return v
+}
+
+func (s *screen) resync(player defusedivision.Player) {
+	s.last = "resynced as " + player.Name
+	s.planned = nil
+	s.show(player)
+}
+
+// show makes player's board the latest board.
+func (s *screen) show(player defusedivision.Player) {
+	mf, err := solver.NewMinefield(player.Field)
+	if err != nil {
+		return
+	}
+	for _, c := range mf.Cells {
+		if prob, ok := s.probs[[2]int{c.X, c.Y}]; ok && !c.Probed {
+			c.MineProb = prob
+		}
+	}
+	s.board = mf
+	if selected := player.Field.Selected; len(selected) >= 2 {
+		s.cursor = [2]int{selected[0], selected[1]}
+	}
+	if !player.Living {
+		s.last += ", and exploded"
+	} else if player.Field.Victory {
+		s.last += ", and won"
+	}
+}
+
+// skipProbed drops the planned probes of cells which earlier actions opened,
+// since the game skips them too.
+func (s *screen) skipProbed() {
+	for len(s.planned) > 0 && s.planned[0].Kind == solver.ActionProbe {
+		if c := s.cell(s.planned[0].Cell); c == nil || !c.Probed {
+			return
+		}
+		s.planned = s.planned[1:]
+	}
+}
+
+func (s *screen) cell(xy [2]int) *solver.Cell {
+	if s.board == nil || xy[0] < 0 || xy[0] >= s.board.Width || xy[1] < 0 || xy[1] >= s.board.Height {
+		return nil
+	}
+	return s.board.Cells[xy[0]+xy[1]*s.board.Width]
+}
+
+// render returns the board with the panel beside it, and status below.
+func (s *screen) render(status string) string {
+	var next *solver.Action
+	if len(s.planned) > 0 {
+		next = &s.planned[0]
+	}
+	board := []string{}
+	if s.board != nil {
+		for y := 0; y < s.board.Height; y++ {
+			row := ""
+			for x := 0; x < s.board.Width; x++ {
+				xy := [2]int{x, y}
+				row += drawCell(s.cell(xy), xy == s.cursor, next != nil && next.Cell == xy)
+			}
+			board = append(board, row)
+		}
+	}
+	width := 0
+	if s.board != nil {
+		width = 3 * s.board.Width
+	}
+
+	panel := []string{
+		fmt.Sprintf("strategy: %s", s.strategy),
+		fmt.Sprintf("moves:    %d", s.moves),
+		"",
+	}
+	if next != nil {
+		panel = append(panel,
+			fmt.Sprintf("next: %s (%d, %d)", next.Kind, next.Cell[0], next.Cell[1]),
+			"  "+next.Justification.String(),
+		)
+		if len(s.planned) > 1 {
+			panel = append(panel, fmt.Sprintf("  then %d more planned", len(s.planned)-1))
+		}
+	} else {
+		panel = append(panel, "next: waiting for the strategy")
+	}
+	if s.last != "" {
+		panel = append(panel, "", "last: "+s.last)
+	}
+
+	var b strings.Builder
+	for idx := 0; idx < len(board) || idx < len(panel); idx++ {
+		if idx < len(board) {
+			b.WriteString(board[idx])
+		} else {
+			b.WriteString(strings.Repeat(" ", width))
+		}
+		if idx < len(panel) {
+			b.WriteString("   " + panel[idx])
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("\n" + status + "\n")
+	return b.String()
+}
+
+// drawCell draws c as three characters, coloured by what is known of it.
+func drawCell(c *solver.Cell, cursor, next bool) string {
+	text, colour := "   ", ""
+	switch {
+	case c.Probed && c.MineTouch == 0:
+		text = " . "
+	case c.Probed:
+		text = fmt.Sprintf(" %d ", c.MineTouch)
+	case c.Flagged:
+		text, colour = " F ", "\x1b[1;37;41m"
+	case c.MineProb < 0.0:
+		text, colour = " ? ", "\x1b[37;100m"
+	case c.MineProb == 0.0:
+		text, colour = " 0 ", "\x1b[30;42m"
+	case c.MineProb >= 1.0:
+		text, colour = " * ", "\x1b[1;37;41m"
+	case c.MineProb < 0.5:
+		text, colour = fmt.Sprintf("%2.0f ", c.MineProb*100), "\x1b[30;43m"
+	default:
+		text, colour = fmt.Sprintf("%2.0f ", c.MineProb*100), "\x1b[30;45m"
+	}
+	if cursor {
+		colour += reverse
+	}
+	if next {
+		colour += underline
+	}
+	if colour == "" {
+		return text
+	}
+	return colour + text + reset
+}
+
+// Raw puts the terminal f into cbreak mode, so that each key is read as soon
+// as it is pressed rather than once enter is, and returns a function which
+// puts it back. It needs stty, so it fails where there isn't one; keys then
+// only arrive with enter.
+func Raw(f *os.File) (restore func() error, err error) {
+	saved, err := stty(f, "-g")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := stty(f, "cbreak", "-echo"); err != nil {
+		return nil, err
+	}
+	return func() error {
+		_, err := stty(f, strings.TrimSpace(saved))
+		return err
+	}, nil
+}
+
+func stty(f *os.File, args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = f
+	out, err := cmd.Output()
+	return string(out), err
+}
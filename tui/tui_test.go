@@ -0,0 +1,237 @@
+package tui
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lelandbatey/minesweeper-solver/defusedivision"
+	"github.com/lelandbatey/minesweeper-solver/engine"
+	"github.com/lelandbatey/minesweeper-solver/runner"
+	"github.com/lelandbatey/minesweeper-solver/solver"
+)
+
+// syncBuffer is a bytes.Buffer which a TUI can draw to while a test reads it.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestRenderHighlightsCursorAndNext(t *testing.T) {
+	g, err := engine.New(4, 4, 2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mf, err := solver.NewMinefield(g.Minefield())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range mf.Cells {
+		c.MineProb = 0.25
+	}
+	next := solver.Action{Kind: solver.ActionProbe, Cell: [2]int{2, 1}, Justification: solver.Justification{Rule: solver.RuleMineCount, Probability: 0.25}}
+	s := screen{strategy: "exact", cursor: [2]int{1, 3}}
+	s.decide(mf, []solver.Action{next})
+	out := s.render("paused")
+
+	lines := strings.Split(out, "\n")
+	if !strings.Contains(lines[3], reverse) {
+		t.Errorf("cursor isn't highlighted on row 3: %q", lines[3])
+	}
+	if !strings.Contains(lines[1], underline) {
+		t.Errorf("next probe isn't highlighted on row 1: %q", lines[1])
+	}
+	if !strings.Contains(out, "next: probe (2, 1)") || !strings.Contains(out, next.Justification.String()) {
+		t.Errorf("panel doesn't explain the next probe:\n%s", out)
+	}
+	if !strings.Contains(out, "25 ") {
+		t.Errorf("probabilities aren't drawn:\n%s", out)
+	}
+}
+
+func TestStepAndRun(t *testing.T) {
+	g, err := engine.New(9, 9, 10, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, press := io.Pipe()
+	defer press.Close()
+	var out syncBuffer
+	ui := New(&out, keys, "exact", nil)
+	ui.Delay = time.Millisecond
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := runner.PlayRecorded(context.Background(), runner.Local{Game: g}, solver.ExactStrategy{}, [2]int{0, 0}, nil, ui)
+		done <- err
+	}()
+	// paused, the game waits after the first probe until a step
+	time.Sleep(50 * time.Millisecond)
+	if strings.Count(out.String(), home) != 1 || g.Over() {
+		t.Fatalf("game went on while paused")
+	}
+	press.Write([]byte("s"))
+	time.Sleep(50 * time.Millisecond)
+	if n := strings.Count(out.String(), home); n != 2 {
+		t.Errorf("one step drew %d screens, want 2", n)
+	}
+	press.Write([]byte("r"))
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("running game didn't finish")
+	}
+	if !g.Over() {
+		t.Errorf("game isn't over")
+	}
+}
+
+func TestQuit(t *testing.T) {
+	g, err := engine.New(9, 9, 10, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, press := io.Pipe()
+	defer press.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	ui := New(ioutil.Discard, keys, "exact", cancel)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := runner.PlayRecorded(ctx, runner.Local{Game: g}, solver.ExactStrategy{}, [2]int{0, 0}, nil, ui)
+		done <- err
+	}()
+	press.Write([]byte("q"))
+	select {
+	case err := <-done:
+		if err == nil && !g.Over() {
+			t.Errorf("quitting left the game unfinished without an error")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("game didn't stop after quitting")
+	}
+}
+
+func TestIntervene(t *testing.T) {
+	g, err := engine.New(9, 9, 10, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the same game, to find a cell still covered after the first probe
+	peek, err := engine.New(9, 9, 10, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	peek.Probe(0, 0)
+	var target [2]int
+	for _, c := range peek.Minefield().Cells {
+		if !c.Probed {
+			target = [2]int{c.X, c.Y}
+			break
+		}
+	}
+
+	keys, press := io.Pipe()
+	defer press.Close()
+	ui := New(ioutil.Discard, keys, "exact", nil)
+	defer ui.Close()
+	ui.Delay = time.Millisecond
+	moves := &moveLog{}
+	done := make(chan error, 1)
+	go func() {
+		// moves is told first, since the TUI holds the game up
+		_, err := runner.PlayRecorded(context.Background(), runner.Local{Game: g}, solver.ExactStrategy{}, [2]int{0, 0}, nil, runner.MultiRecorder(moves, ui))
+		done <- err
+	}()
+	// the cursor is at the first probe, and is moved with both kinds of
+	// keys
+	path := strings.Repeat("\x1b[C", target[0]) + strings.Repeat("j", target[1])
+	press.Write([]byte(path + "f"))
+	deadline := time.Now().Add(time.Second)
+	for !moves.has(solver.ActionFlag, target) {
+		if time.Now().After(deadline) {
+			t.Fatalf("no flag of %v among %v", target, moves.all())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := moves.all(); len(got) != 2 {
+		t.Errorf("moves %v, want the first probe then the flag", got)
+	}
+	press.Write([]byte("r"))
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("game didn't finish after the intervention")
+	}
+}
+
+// moveLog is a Recorder noting the actions of each move.
+type moveLog struct {
+	mu      sync.Mutex
+	actions []solver.Action
+}
+
+func (m *moveLog) Decided(mf *solver.Minefield, actions []solver.Action) {}
+func (m *moveLog) Resynced(player defusedivision.Player)                 {}
+
+func (m *moveLog) Moved(move runner.Move) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.actions = append(m.actions, move.Action)
+}
+
+func (m *moveLog) all() []solver.Action {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]solver.Action{}, m.actions...)
+}
+
+func (m *moveLog) has(kind solver.ActionKind, xy [2]int) bool {
+	for _, action := range m.all() {
+		if action.Kind == kind && action.Cell == xy {
+			return true
+		}
+	}
+	return false
+}
+
+func TestCloseStopsReading(t *testing.T) {
+	keys, press := io.Pipe()
+	defer press.Close()
+	before := runtime.NumGoroutine()
+	ui := New(ioutil.Discard, keys, "exact", nil)
+	ui.Close()
+	// the key is read, but nothing waits for it
+	press.Write([]byte("s"))
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			t.Fatal("still reading keys after Close")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
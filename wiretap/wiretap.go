@@ -0,0 +1,178 @@
+// Package wiretap records the raw bytes a client and a DefuseDivision server
+// exchange, and plays them back as a fake server, so that whatever happened
+// against a real server can be reproduced offline, byte for byte.
+//
+// A tape is a file of JSON values, one per line, each being something which
+// happened on one of the recorded connections, numbered from 1:
+//
+//	{"conn": 1, "time": ..., "recv": "H4sIAAAA..."}  bytes the client read
+//	{"conn": 1, "time": ..., "sent": "H4sIAAAA..."}  bytes the client wrote
+//	{"conn": 1, "time": ..., "closed": "EOF"}        the server ended it
+//	{"conn": 1, "time": ..., "closed": "closed", "local": true}
+//	                                                 the client ended it
+//
+// Bytes are recorded as they were read or written, still framed, and encoded
+// in base64.
+//
+// To record every connection of a client, and later play them back:
+//
+//	tape := wiretap.NewTape(f)
+//	c, err := client.Dial(ctx, tape.Dial(dial))
+//	...
+//	scripts, err := wiretap.Scripts(f)
+//	s := fakeserver.Start(scripts[0]...)
+//	c := client.NewConn(s.Client)
+package wiretap
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/lelandbatey/minesweeper-solver/fakeserver"
+)
+
+// entry is a single line of a tape, with one of Recv, Sent or Closed set.
+// Local is set with Closed when the client closed the connection itself.
+type entry struct {
+	Conn   int       `json:"conn"`
+	Time   time.Time `json:"time"`
+	Recv   []byte    `json:"recv,omitempty"`
+	Sent   []byte    `json:"sent,omitempty"`
+	Closed string    `json:"closed,omitempty"`
+	Local  bool      `json:"local,omitempty"`
+}
+
+// A Tape records connections to an io.Writer. It is safe to use from many
+// goroutines, as a client's connections are.
+type Tape struct {
+	mu    sync.Mutex
+	enc   *json.Encoder
+	conns int
+	err   error
+}
+
+// NewTape returns a Tape recording to w.
+func NewTape(w io.Writer) *Tape {
+	return &Tape{enc: json.NewEncoder(w)}
+}
+
+// Err returns the first error writing the tape, if any. A Tape stops writing
+// after an error, but the connections carry on.
+func (t *Tape) Err() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.err
+}
+
+func (t *Tape) write(e entry) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.err == nil {
+		e.Time = time.Now()
+		t.err = t.enc.Encode(e)
+	}
+}
+
+// Conn returns conn, recording everything read from and written to it as the
+// next connection of the tape.
+func (t *Tape) Conn(conn net.Conn) net.Conn {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.conns += 1
+	return &tappedConn{Conn: conn, tape: t, id: t.conns}
+}
+
+// Dial returns dial, with every connection it makes recorded.
+func (t *Tape) Dial(dial func(ctx context.Context) (net.Conn, error)) func(ctx context.Context) (net.Conn, error) {
+	return func(ctx context.Context) (net.Conn, error) {
+		conn, err := dial(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return t.Conn(conn), nil
+	}
+}
+
+// A tappedConn is a connection being recorded to a tape.
+type tappedConn struct {
+	net.Conn
+	tape *Tape
+	id   int
+
+	closeOnce sync.Once
+}
+
+func (c *tappedConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.tape.write(entry{Conn: c.id, Recv: append([]byte(nil), b[:n]...)})
+	}
+	if err != nil {
+		// only the first error ends the connection, and none after the
+		// client closed it
+		c.closeOnce.Do(func() {
+			c.tape.write(entry{Conn: c.id, Closed: err.Error()})
+		})
+	}
+	return n, err
+}
+
+func (c *tappedConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.tape.write(entry{Conn: c.id, Closed: "closed", Local: true})
+	})
+	return c.Conn.Close()
+}
+
+func (c *tappedConn) Write(b []byte) (int, error) {
+	// recorded before it's written, so that the server's answer can't be
+	// recorded first
+	if len(b) > 0 {
+		c.tape.write(entry{Conn: c.id, Sent: append([]byte(nil), b...)})
+	}
+	return c.Conn.Write(b)
+}
+
+// Scripts reads a tape, and returns a fakeserver script for each of its
+// connections in the order they were made. Each script sends the client what
+// it received, and expects exactly the bytes it sent, in the order they were
+// recorded, then disconnects where the server ended the connection. Where the
+// client ended it, the script just ends, leaving the client to close it
+// again.
+func Scripts(r io.Reader) ([][]fakeserver.Step, error) {
+	dec := json.NewDecoder(r)
+	var scripts [][]fakeserver.Step
+	for line := 1; ; line++ {
+		var e entry
+		err := dec.Decode(&e)
+		if err == io.EOF {
+			return scripts, nil
+		}
+		if err != nil {
+			return scripts, fmt.Errorf("line %d: %v", line, err)
+		}
+		if e.Conn < 1 {
+			return scripts, fmt.Errorf("line %d: no connection %d", line, e.Conn)
+		}
+		for len(scripts) < e.Conn {
+			scripts = append(scripts, nil)
+		}
+		idx := e.Conn - 1
+		switch {
+		case len(e.Recv) > 0:
+			scripts[idx] = append(scripts[idx], fakeserver.Raw(e.Recv))
+		case len(e.Sent) > 0:
+			scripts[idx] = append(scripts[idx], fakeserver.ExpectRaw(e.Sent))
+		case e.Closed != "" && e.Local:
+		case e.Closed != "":
+			scripts[idx] = append(scripts[idx], fakeserver.Disconnect())
+		default:
+			return scripts, fmt.Errorf("line %d: empty entry", line)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package wiretap
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lelandbatey/minesweeper-solver/client"
+	"github.com/lelandbatey/minesweeper-solver/fakeserver"
+	"github.com/lelandbatey/minesweeper-solver/runner"
+	"github.com/lelandbatey/minesweeper-solver/server"
+	"github.com/lelandbatey/minesweeper-solver/solver"
+)
+
+// serve starts a server on a free local port, and returns a dial function for
+// it. The server is stopped when the test ends.
+func serve(t *testing.T, config server.Config) func(context.Context) (net.Conn, error) {
+	t.Helper()
+	s, err := server.New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- s.Serve(ctx, l) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("serve: %v", err)
+		}
+	})
+	return func(ctx context.Context) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "tcp", l.Addr().String())
+	}
+}
+
+// play plays a game of exact with c, and closes c.
+func play(t *testing.T, ctx context.Context, c *client.Client) runner.Result {
+	t.Helper()
+	defer c.Close()
+	if _, err := c.Player(ctx); err != nil {
+		t.Fatal(err)
+	}
+	result, err := runner.Play(ctx, c, solver.ExactStrategy{}, [2]int{2, 2}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestReplayGame(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	var buf bytes.Buffer
+	tape := NewTape(&buf)
+	c, err := client.Dial(ctx, tape.Dial(serve(t, server.Config{Width: 5, Height: 5, Mines: 3, Seed: 7, ZeroOpening: true})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := play(t, ctx, c)
+	if err := tape.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	scripts, err := Scripts(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scripts) != 1 {
+		t.Fatalf("tape has %d connections, want 1", len(scripts))
+	}
+	s := fakeserver.Start(scripts[0]...)
+	defer s.Close()
+	got := play(t, ctx, client.NewConn(s.Client))
+	if err := s.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if got.Won != want.Won || got.Moves != want.Moves || got.Guesses != want.Guesses {
+		t.Errorf("replay got %+v, recording got %+v", got, want)
+	}
+}
+
+func TestReplayExpectsRecordedBytes(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var buf bytes.Buffer
+	tape := NewTape(&buf)
+	c, err := client.Dial(ctx, tape.Dial(serve(t, server.Config{Width: 5, Height: 5, Mines: 3, Seed: 7})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Player(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.MoveDown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+
+	scripts, err := Scripts(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := fakeserver.Start(scripts[0]...)
+	defer s.Close()
+	c = client.NewConn(s.Client)
+	defer c.Close()
+	c.Timeout = 100 * time.Millisecond
+	if _, err := c.Player(ctx); err != nil {
+		t.Fatal(err)
+	}
+	c.MoveRight(ctx)
+	if err := s.Wait(); err == nil {
+		t.Errorf("replay accepted RIGHT where DOWN was recorded")
+	}
+}
+
+func TestScriptsDisconnectOnlyWhereTheServerDid(t *testing.T) {
+	var buf bytes.Buffer
+	tape := NewTape(&buf)
+
+	// the server hangs up on the first connection
+	client, server := net.Pipe()
+	conn := tape.Conn(client)
+	server.Close()
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Fatal("read from a closed pipe")
+	}
+	conn.Close()
+
+	// the client hangs up on the second, which its reader then notices
+	client, server = net.Pipe()
+	defer server.Close()
+	conn = tape.Conn(client)
+	conn.Close()
+	conn.Read(make([]byte, 1))
+
+	scripts, err := Scripts(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scripts) != 2 {
+		t.Fatalf("tape has %d connections, want 2", len(scripts))
+	}
+	if len(scripts[0]) != 1 {
+		t.Errorf("server's hang up replays as %d steps, want a disconnect", len(scripts[0]))
+	}
+	if len(scripts[1]) != 0 {
+		t.Errorf("client's hang up replays as %d steps, want none", len(scripts[1]))
+	}
+}